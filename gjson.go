@@ -8,9 +8,24 @@
 package gjson
 
 import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
 	"iter"
+	"math"
+	"net/url"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unicode/utf16"
 	"unicode/utf8"
@@ -321,7 +336,29 @@ func (t Result) Map() map[string]Result {
 // Get searches result for the specified path.
 // The result should be a JSON array or object.
 func (t Result) Get(path string) Result {
-	r := Get(t.Raw, path)
+	ev := evaluator{engine: defaultEngine, root: t.Raw, path: path}
+	return ev.getResult(t, path)
+}
+
+// getElem searches an array element for the path, where rest is the path
+// that selected the elements, which is used for the paths of the modifiers.
+func (ev *evaluator) getElem(t Result, path, rest string, index int) Result {
+	if strings.IndexByte(path, '@') == -1 {
+		return ev.getResult(t, path)
+	}
+	var text string
+	if n := len(ev.path) - len(rest); n >= 0 && sameEnd(ev.path, rest) {
+		text = ev.path[:n]
+	}
+	prev := ev.enterPath(pathPart{text: text, index: index}, path)
+	res := ev.getResult(t, path)
+	ev.leavePath(prev)
+	return res
+}
+
+// getResult searches the result for the specified path.
+func (ev *evaluator) getResult(t Result, path string) Result {
+	r := ev.get(t.Raw, path)
 	if r.Indexes != nil {
 		for i := 0; i < len(r.Indexes); i++ {
 			r.Indexes[i] += t.Index
@@ -771,7 +808,7 @@ type arrayPathResult struct {
 	}
 }
 
-func parseArrayPath(path string) (r arrayPathResult) {
+func parseArrayPath(e *Engine, path string) (r arrayPathResult) {
 	for i := 0; i < len(path); i++ {
 		if path[i] == '|' {
 			r.part = path[:i]
@@ -781,7 +818,7 @@ func parseArrayPath(path string) (r arrayPathResult) {
 		}
 		if path[i] == '.' {
 			r.part = path[:i]
-			if !r.arrch && i < len(path)-1 && isDotPiperChar(path[i+1:]) {
+			if !r.arrch && i < len(path)-1 && isDotPiperChar(e, path[i+1:]) {
 				r.pipe = path[i+1:]
 				r.piped = true
 			} else {
@@ -951,8 +988,8 @@ right:
 }
 
 // peek at the next byte and see if it's a '@', '[', or '{'.
-func isDotPiperChar(s string) bool {
-	if DisableModifiers {
+func isDotPiperChar(e *Engine, s string) bool {
+	if e.modifiersDisabled() {
 		return false
 	}
 	c := s[0]
@@ -964,8 +1001,7 @@ func isDotPiperChar(s string) bool {
 				break
 			}
 		}
-		_, ok := modifiers[s[1:i]]
-		return ok
+		return e.ModifierExists(s[1:i])
 	}
 	return c == '[' || c == '{'
 }
@@ -979,7 +1015,7 @@ type objectPathResult struct {
 	more  bool
 }
 
-func parseObjectPath(path string) (r objectPathResult) {
+func parseObjectPath(e *Engine, path string) (r objectPathResult) {
 	for i := 0; i < len(path); i++ {
 		if path[i] == '|' {
 			r.part = path[:i]
@@ -989,7 +1025,7 @@ func parseObjectPath(path string) (r objectPathResult) {
 		}
 		if path[i] == '.' {
 			r.part = path[:i]
-			if i < len(path)-1 && isDotPiperChar(path[i+1:]) {
+			if i < len(path)-1 && isDotPiperChar(e, path[i+1:]) {
 				r.pipe = path[i+1:]
 				r.piped = true
 			} else {
@@ -1019,7 +1055,7 @@ func parseObjectPath(path string) (r objectPathResult) {
 						continue
 					} else if path[i] == '.' {
 						r.part = string(epart)
-						if i < len(path)-1 && isDotPiperChar(path[i+1:]) {
+						if i < len(path)-1 && isDotPiperChar(e, path[i+1:]) {
 							r.pipe = path[i+1:]
 							r.piped = true
 						} else {
@@ -1193,10 +1229,12 @@ func parseSquash(json string, i int) (int, string) {
 	return i, json[s:]
 }
 
-func parseObject(c *parseContext, i int, path string) (int, bool) {
+func parseObject(c *parseContext, ev *evaluator, i int, path string,
+) (int, bool) {
 	var pmatch, kesc, vesc, ok, hit bool
 	var key, val string
-	rp := parseObjectPath(path)
+	rp := parseObjectPath(ev.engine, path)
+	budgeted := ev.budget != nil
 	if !rp.more && rp.piped {
 		c.pipe = rp.pipe
 		c.piped = true
@@ -1255,6 +1293,9 @@ func parseObject(c *parseContext, i int, path string) (int, bool) {
 		if !ok {
 			return i, false
 		}
+		if budgeted && !ev.step() {
+			return len(c.json), false
+		}
 		if rp.wild {
 			if kesc {
 				pmatch = matchLimit(unescape(key), rp.part)
@@ -1292,7 +1333,7 @@ func parseObject(c *parseContext, i int, path string) (int, bool) {
 				}
 			case '{':
 				if pmatch && !hit {
-					i, hit = parseObject(c, i+1, rp.path)
+					i, hit = parseObject(c, ev, i+1, rp.path)
 					if hit {
 						return i, true
 					}
@@ -1306,7 +1347,7 @@ func parseObject(c *parseContext, i int, path string) (int, bool) {
 				}
 			case '[':
 				if pmatch && !hit {
-					i, hit = parseArray(c, i+1, rp.path)
+					i, hit = parseArray(c, ev, i+1, rp.path)
 					if hit {
 						return i, true
 					}
@@ -1505,7 +1546,8 @@ func queryMatches(rp *arrayPathResult, value Result) bool {
 	}
 	return false
 }
-func parseArray(c *parseContext, i int, path string) (int, bool) {
+func parseArray(c *parseContext, ev *evaluator, i int, path string,
+) (int, bool) {
 	var pmatch, vesc, ok, hit bool
 	var val string
 	var h int
@@ -1513,7 +1555,14 @@ func parseArray(c *parseContext, i int, path string) (int, bool) {
 	var partidx int
 	var multires []byte
 	var queryIndexes []int
-	rp := parseArrayPath(path)
+	rp := parseArrayPath(ev.engine, path)
+	budgeted := ev.budget != nil
+	if rp.query.on && ev.engine.policy != nil {
+		if err := ev.engine.checkPolicy("queries"); err != nil {
+			ev.err = err
+			return len(c.json), false
+		}
+	}
 	if !rp.arrch {
 		n, ok := parseUint(rp.part)
 		if !ok {
@@ -1539,7 +1588,7 @@ func parseArray(c *parseContext, i int, path string) (int, bool) {
 		parentIndex := tmp.value.Index
 		var res Result
 		if qval.Type == JSON {
-			res = qval.Get(rp.query.path)
+			res = ev.getElem(qval, rp.query.path, path, h-1)
 		} else {
 			if rp.query.path != "" {
 				return false
@@ -1554,7 +1603,7 @@ func parseArray(c *parseContext, i int, path string) (int, bool) {
 					c.pipe = right
 					c.piped = true
 				}
-				res = qval.Get(rp.path)
+				res = ev.getElem(qval, rp.path, path, h-1)
 			} else {
 				res = qval
 			}
@@ -1583,6 +1632,9 @@ func parseArray(c *parseContext, i int, path string) (int, bool) {
 			hit = pmatch && !rp.more
 		}
 		h++
+		if budgeted && !ev.step() {
+			return len(c.json), false
+		}
 		if rp.alogok {
 			alog = append(alog, i)
 		}
@@ -1632,7 +1684,7 @@ func parseArray(c *parseContext, i int, path string) (int, bool) {
 				}
 			case '{':
 				if pmatch && !hit {
-					i, hit = parseObject(c, i+1, rp.path)
+					i, hit = parseObject(c, ev, i+1, rp.path)
 					if hit {
 						if rp.alogok {
 							break
@@ -1656,7 +1708,7 @@ func parseArray(c *parseContext, i int, path string) (int, bool) {
 				}
 			case '[':
 				if pmatch && !hit {
-					i, hit = parseArray(c, i+1, rp.path)
+					i, hit = parseArray(c, ev, i+1, rp.path)
 					if hit {
 						if rp.alogok {
 							break
@@ -1740,7 +1792,7 @@ func parseArray(c *parseContext, i int, path string) (int, bool) {
 							if idx < len(c.json) && c.json[idx] != ']' {
 								_, res, ok := parseAny(c.json, idx, true)
 								if ok {
-									res := res.Get(rp.alogkey)
+									res := ev.getElem(res, rp.alogkey, path, j)
 									if res.Exists() {
 										if k > 0 {
 											jsons = append(jsons, ',')
@@ -1913,6 +1965,34 @@ func ForEachLine(json string, iterator func(line Result) bool) {
 	}
 }
 
+// ForEachLineContext iterates through lines of JSON, like ForEachLine, and
+// stops with ctx.Err() when the context is canceled or its deadline is
+// exceeded. The context is checked before each line.
+func ForEachLineContext(ctx context.Context, json string,
+	iterator func(line Result) bool,
+) error {
+	var res Result
+	var i int
+	done := ctx.Done()
+	for {
+		if done != nil {
+			select {
+			case <-done:
+				return ctx.Err()
+			default:
+			}
+		}
+		i, res, _ = parseAny(json, i, true)
+		if !res.Exists() {
+			break
+		}
+		if !iterator(res) {
+			break
+		}
+	}
+	return nil
+}
+
 type subSelector struct {
 	name string
 	path string
@@ -2094,6 +2174,223 @@ type parseContext struct {
 	lines bool
 }
 
+// evaluator holds the state of a single evaluation of a path.
+type evaluator struct {
+	engine *Engine
+	root   string     // the json that the evaluation started with
+	path   string     // the path that is evaluated on the value at base
+	base   []pathPart // path of the value that path is evaluated on
+	err    error      // the first error returned by a modifier
+	budget *budget
+}
+
+// pathPart is a part of the path from the root to a value, which is used for
+// ModContext.Path. The index of an array element follows the text, unless
+// it's negative.
+type pathPart struct {
+	text  string
+	index int
+}
+
+// enterPath starts the evaluation of a nested path, such as the path of a
+// multipath or the path that follows "#.", on the value at the part. The
+// returned path must be passed to leavePath.
+func (ev *evaluator) enterPath(part pathPart, path string) string {
+	ev.base = append(ev.base, part)
+	prev := ev.path
+	ev.path = path
+	return prev
+}
+
+// leavePath ends the evaluation of a nested path.
+func (ev *evaluator) leavePath(prev string) {
+	ev.base = ev.base[:len(ev.base)-1]
+	ev.path = prev
+}
+
+// prefix returns the part of ev.path that comes before rest, which is a
+// component that was sliced from ev.path, without the separator.
+func (ev *evaluator) prefix(rest string) string {
+	n := len(ev.path) - len(rest)
+	if n < 0 || !sameEnd(ev.path, rest) {
+		return ""
+	}
+	prefix := ev.path[:n]
+	if n > 0 && (prefix[n-1] == '.' || prefix[n-1] == '|') {
+		prefix = prefix[:n-1]
+	}
+	return prefix
+}
+
+// valuePath returns the path of the value that the modifier at the start of
+// mpath is applied to, which is a path that returns the value when it's
+// evaluated on the root.
+func (ev *evaluator) valuePath(mpath string) string {
+	var path []byte
+	var elem bool // the previous part is an array element
+	add := func(text string) {
+		if len(path) > 0 && text != "" {
+			if elem {
+				path = append(path, '.')
+			} else {
+				path = append(path, '|')
+			}
+		}
+		path = append(path, text...)
+	}
+	for _, part := range ev.base {
+		if part.index < 0 {
+			add(part.text)
+			elem = false
+			continue
+		}
+		add(part.text + strconv.Itoa(part.index))
+		elem = true
+	}
+	add(ev.prefix(mpath))
+	if len(path) == 0 {
+		return "@this"
+	}
+	return string(path)
+}
+
+// sameEnd returns true when a and b end at the same memory, such as a path
+// and a component that was sliced from its end.
+func sameEnd(a, b string) bool {
+	ah := (*stringHeader)(unsafe.Pointer(&a))
+	bh := (*stringHeader)(unsafe.Pointer(&b))
+	return uintptr(ah.data)+uintptr(ah.len) == uintptr(bh.data)+uintptr(bh.len)
+}
+
+// budget tracks the resources that are used by an evaluation, including the
+// paths that are evaluated by its modifiers, and checks if the evaluation was
+// canceled. It's only used when the engine has limits or the evaluation has a
+// context that can be canceled.
+type budget struct {
+	config    *Config
+	ctx       context.Context
+	done      <-chan struct{}
+	steps     int
+	modifiers int
+	depth     int
+}
+
+// cancelCheckSteps is the number of steps between checks of a context.
+const cancelCheckSteps = 64
+
+// newBudget returns a new budget for an evaluation, or nil when the engine
+// has no limits.
+func (e *Engine) newBudget() *budget {
+	if !e.config.hasLimits() {
+		return nil
+	}
+	return &budget{config: &e.config}
+}
+
+// hasLimits returns true when the config limits the resources of an
+// evaluation.
+func (c *Config) hasLimits() bool {
+	return c.MaxDepth > 0 || c.MaxResultSize > 0 || c.MaxModifiers > 0 ||
+		c.MaxSteps > 0
+}
+
+// newContextBudget returns a new budget for an evaluation that can be
+// canceled using ctx.
+func (e *Engine) newContextBudget(ctx context.Context) *budget {
+	done := ctx.Done()
+	if done == nil {
+		return e.newBudget()
+	}
+	return &budget{config: &e.config, ctx: ctx, done: done}
+}
+
+// step uses one step of the budget, and periodically checks if the
+// evaluation was canceled.
+func (b *budget) step() error {
+	b.steps++
+	if b.config.MaxSteps > 0 && b.steps > b.config.MaxSteps {
+		return &LimitError{Limit: "steps", Max: b.config.MaxSteps}
+	}
+	if b.done != nil && b.steps%cancelCheckSteps == 0 {
+		select {
+		case <-b.done:
+			return b.ctx.Err()
+		default:
+		}
+	}
+	return nil
+}
+
+// canceled returns true when err was caused by the cancellation of the
+// evaluation.
+func (b *budget) canceled(err error) bool {
+	return b != nil && b.ctx != nil && b.ctx.Err() != nil &&
+		errors.Is(err, b.ctx.Err())
+}
+
+// enter increases the depth of the evaluation. The depth is unchanged when
+// an error is returned, otherwise leave must be called.
+func (b *budget) enter() error {
+	if b.config.MaxDepth > 0 && b.depth >= b.config.MaxDepth {
+		return &LimitError{Limit: "depth", Max: b.config.MaxDepth}
+	}
+	if err := b.step(); err != nil {
+		return err
+	}
+	b.depth++
+	return nil
+}
+
+// leave decreases the depth of the evaluation.
+func (b *budget) leave() {
+	b.depth--
+}
+
+// modifier uses one modifier of the budget.
+func (b *budget) modifier() error {
+	b.modifiers++
+	if b.config.MaxModifiers > 0 && b.modifiers > b.config.MaxModifiers {
+		return &LimitError{Limit: "modifiers", Max: b.config.MaxModifiers}
+	}
+	return b.step()
+}
+
+// size checks the size of json that was built by the evaluation.
+func (b *budget) size(n int) error {
+	if b.config.MaxResultSize > 0 && n > b.config.MaxResultSize {
+		return &LimitError{Limit: "result size", Max: b.config.MaxResultSize}
+	}
+	return nil
+}
+
+// walk uses the budget for a value and all of its nested values, where each
+// array and object is a level of depth.
+func (b *budget) walk(res Result) error {
+	if !res.IsObject() && !res.IsArray() {
+		return b.step()
+	}
+	if err := b.enter(); err != nil {
+		return err
+	}
+	var err error
+	res.ForEach(func(_, value Result) bool {
+		err = b.walk(value)
+		return err == nil
+	})
+	b.leave()
+	return err
+}
+
+// step uses one step of the budget, and returns false when the evaluation
+// must stop.
+func (ev *evaluator) step() bool {
+	if err := ev.budget.step(); err != nil {
+		ev.err = err
+		return false
+	}
+	return true
+}
+
 // Get searches json for the specified path.
 // A path is in dot syntax, such as "name.last" or "age".
 // When the value is found it's returned immediately.
@@ -2128,21 +2425,124 @@ type parseContext struct {
 // If you are consuming JSON from an unpredictable source then you may want to
 // use the Valid function first.
 func Get(json, path string) Result {
+	// the default engine has no policy or limits
+	ev := evaluator{engine: defaultEngine, root: json, path: path}
+	res := ev.search(json, path)
+	if ev.err != nil {
+		return Result{}
+	}
+	return res
+}
+
+// GetE searches json for the specified path, like Get, but also returns the
+// first error that was returned by a modifier. See AddModifierFunc.
+func GetE(json, path string) (Result, error) {
+	return defaultEngine.GetE(json, path)
+}
+
+// GetContext searches json for the specified path, like GetE, and stops
+// with ctx.Err() when the context is canceled or its deadline is exceeded.
+func GetContext(ctx context.Context, json, path string) (Result, error) {
+	return defaultEngine.GetContext(ctx, json, path)
+}
+
+// Get searches json for the specified path using the modifiers and options
+// of the engine. See the Get function for more information.
+func (e *Engine) Get(json, path string) Result {
+	if e.policy != nil || e.config.hasLimits() {
+		res, _ := e.GetE(json, path)
+		return res
+	}
+	// without a policy and limits, the only errors are from modifiers
+	ev := evaluator{engine: e, root: json, path: path}
+	res := ev.search(json, path)
+	if ev.err != nil {
+		return Result{}
+	}
+	return res
+}
+
+// GetE searches json for the specified path using the modifiers and options
+// of the engine, and returns the first error that was returned by a
+// modifier. An empty result is returned with the error.
+func (e *Engine) GetE(json, path string) (Result, error) {
+	return e.eval(json, path, e.newBudget())
+}
+
+// GetContext searches json for the specified path using the modifiers and
+// options of the engine, and stops with ctx.Err() when the context is
+// canceled or its deadline is exceeded.
+func (e *Engine) GetContext(ctx context.Context, json, path string) (
+	Result, error,
+) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	return e.eval(json, path, e.newContextBudget(ctx))
+}
+
+// eval searches json for the specified path, using the budget for the limits
+// and cancellation.
+func (e *Engine) eval(json, path string, b *budget) (Result, error) {
+	if e.policy != nil && e.policy.MaxPathLength > 0 &&
+		len(path) > e.policy.MaxPathLength {
+		return Result{}, &PolicyError{Feature: "path length",
+			Max: e.policy.MaxPathLength}
+	}
+	ev := evaluator{engine: e, root: json, path: path, budget: b}
+	res := ev.get(json, path)
+	if ev.err == nil && ev.budget != nil {
+		ev.err = ev.budget.size(len(res.Raw))
+	}
+	if ev.err != nil {
+		return Result{}, ev.err
+	}
+	return res, nil
+}
+
+// get searches json for the specified path.
+func (ev *evaluator) get(json, path string) Result {
+	if ev.err != nil {
+		return Result{}
+	}
+	if ev.budget == nil {
+		return ev.search(json, path)
+	}
+	if err := ev.budget.enter(); err != nil {
+		ev.err = err
+		return Result{}
+	}
+	res := ev.search(json, path)
+	ev.budget.leave()
+	return res
+}
+
+// search searches json for the specified path, without using the budget
+// for the depth.
+func (ev *evaluator) search(json, path string) Result {
+	e := ev.engine
 	if len(path) > 1 {
-		if (path[0] == '@' && !DisableModifiers) || path[0] == '!' {
+		if (path[0] == '@' && !e.modifiersDisabled()) ||
+			(path[0] == '!' && !e.config.DisableLiterals) {
 			// possible modifier
 			var ok bool
 			var npath string
 			var rjson string
-			if path[0] == '@' && !DisableModifiers {
-				npath, rjson, ok = execModifier(json, path)
-			} else if path[0] == '!' {
+			if path[0] == '@' {
+				npath, rjson, ok = ev.execModifier(json, path)
+			} else {
 				npath, rjson, ok = execStatic(json, path)
+				if ok && e.policy != nil {
+					ev.err = e.checkPolicy("literals")
+				}
+			}
+			if ev.err != nil {
+				return Result{}
 			}
 			if ok {
 				path = npath
 				if len(path) > 0 && (path[0] == '|' || path[0] == '.') {
-					res := Get(rjson, path[1:])
+					res := ev.get(rjson, path[1:])
 					res.Index = 0
 					res.Indexes = nil
 					return res
@@ -2153,16 +2553,33 @@ func Get(json, path string) Result {
 		if path[0] == '[' || path[0] == '{' {
 			// using a subselector path
 			kind := path[0]
+			mpath := path
 			var ok bool
 			var subs []subSelector
 			subs, path, ok = parseSubSelectors(path)
 			if ok {
 				if len(path) == 0 || (path[0] == '|' || path[0] == '.') {
+					if e.policy != nil {
+						if err := e.checkPolicy("multipaths"); err != nil {
+							ev.err = err
+							return Result{}
+						}
+					}
 					var b []byte
 					b = append(b, kind)
 					var i int
 					for _, sub := range subs {
-						res := Get(json, sub.path)
+						var res Result
+						if strings.IndexByte(sub.path, '@') == -1 {
+							res = ev.get(json, sub.path)
+						} else {
+							// the modifiers of the path need its base
+							prev := ev.enterPath(pathPart{
+								text: ev.prefix(mpath), index: -1,
+							}, sub.path)
+							res = ev.get(json, sub.path)
+							ev.leavePath(prev)
+						}
 						if res.Exists() {
 							if i > 0 {
 								b = append(b, ',')
@@ -2198,11 +2615,17 @@ func Get(json, path string) Result {
 						}
 					}
 					b = append(b, kind+2)
+					if ev.budget != nil {
+						if err := ev.budget.size(len(b)); err != nil {
+							ev.err = err
+							return Result{}
+						}
+					}
 					var res Result
 					res.Raw = string(b)
 					res.Type = JSON
 					if len(path) > 0 {
-						res = res.Get(path[1:])
+						res = ev.getResult(res, path[1:])
 					}
 					res.Index = 0
 					return res
@@ -2214,23 +2637,26 @@ func Get(json, path string) Result {
 	var c = &parseContext{json: json}
 	if len(path) >= 2 && path[0] == '.' && path[1] == '.' {
 		c.lines = true
-		parseArray(c, 0, path[2:])
+		parseArray(c, ev, 0, path[2:])
 	} else {
 		for ; i < len(c.json); i++ {
 			if c.json[i] == '{' {
 				i++
-				parseObject(c, i, path)
+				parseObject(c, ev, i, path)
 				break
 			}
 			if c.json[i] == '[' {
 				i++
-				parseArray(c, i, path)
+				parseArray(c, ev, i, path)
 				break
 			}
 		}
 	}
+	if ev.err != nil {
+		return Result{}
+	}
 	if c.piped {
-		res := c.value.Get(c.pipe)
+		res := ev.getResult(c.value, c.pipe)
 		res.Index = 0
 		return res
 	}
@@ -2241,7 +2667,22 @@ func Get(json, path string) Result {
 // GetBytes searches json for the specified path.
 // If working with bytes, this method preferred over Get(string(data), path)
 func GetBytes(json []byte, path string) Result {
-	return getBytes(json, path)
+	res, _ := getBytes(defaultEngine, json, path)
+	return res
+}
+
+// GetBytes searches json for the specified path using the modifiers and
+// options of the engine. See the GetBytes function for more information.
+func (e *Engine) GetBytes(json []byte, path string) Result {
+	res, _ := getBytes(e, json, path)
+	return res
+}
+
+// GetBytesE searches json for the specified path using the modifiers and
+// options of the engine, and returns the first error that was returned by a
+// modifier.
+func (e *Engine) GetBytesE(json []byte, path string) (Result, error) {
+	return getBytes(e, json, path)
 }
 
 // runeit returns the rune from the the \uXXXX
@@ -2452,20 +2893,32 @@ func parseAny(json string, i int, hit bool) (int, Result, bool) {
 // The return value is a Result array where the number of items
 // will be equal to the number of input paths.
 func GetMany(json string, path ...string) []Result {
-	res := make([]Result, len(path))
-	for i, path := range path {
-		res[i] = Get(json, path)
-	}
-	return res
+	return defaultEngine.GetMany(json, path...)
 }
 
 // GetManyBytes searches json for the multiple paths.
 // The return value is a Result array where the number of items
 // will be equal to the number of input paths.
 func GetManyBytes(json []byte, path ...string) []Result {
+	return defaultEngine.GetManyBytes(json, path...)
+}
+
+// GetMany searches json for the multiple paths using the modifiers and
+// options of the engine.
+func (e *Engine) GetMany(json string, path ...string) []Result {
+	res := make([]Result, len(path))
+	for i, path := range path {
+		res[i] = e.Get(json, path)
+	}
+	return res
+}
+
+// GetManyBytes searches json for the multiple paths using the modifiers and
+// options of the engine.
+func (e *Engine) GetManyBytes(json []byte, path ...string) []Result {
 	res := make([]Result, len(path))
 	for i, path := range path {
-		res[i] = GetBytes(json, path)
+		res[i] = e.GetBytes(json, path)
 	}
 	return res
 }
@@ -2764,6 +3217,249 @@ func ValidBytes(json []byte) bool {
 	return ok
 }
 
+// ValidateOptions are the checks of ValidateWithOptions, in addition to the
+// json syntax. The zero value only checks the syntax, like Valid.
+//
+// The I-JSON format (RFC 7493) can be enforced with:
+//
+//	gjson.ValidateOptions{
+//		DisallowDuplicateKeys:  true,
+//		DisallowInvalidUTF8:    true,
+//		DisallowLoneSurrogates: true,
+//		DisallowNumberOverflow: true,
+//	}
+type ValidateOptions struct {
+	// DisallowDuplicateKeys rejects objects that have the same key more than
+	// once. Keys are compared after they are unescaped.
+	DisallowDuplicateKeys bool
+	// DisallowInvalidUTF8 rejects strings that are not valid UTF-8.
+	DisallowInvalidUTF8 bool
+	// DisallowLoneSurrogates rejects strings with an escaped UTF-16
+	// surrogate, such as "\ud800", that is not part of a pair.
+	DisallowLoneSurrogates bool
+	// DisallowNumberOverflow rejects numbers that are too large for a
+	// float64.
+	DisallowNumberOverflow bool
+	// DisallowScalars rejects json that is not an object or an array.
+	DisallowScalars bool
+	// MaxDepth is the maximum nesting of objects and arrays, and zero means
+	// no limit.
+	MaxDepth int
+}
+
+// ValidationError is returned by ValidateWithOptions when the json is not
+// valid.
+type ValidationError struct {
+	Offset int    // byte offset of the problem
+	Msg    string // description of the problem
+}
+
+func (err *ValidationError) Error() string {
+	return "gjson: " + err.Msg + " at offset " + strconv.Itoa(err.Offset)
+}
+
+// ValidateWithOptions returns a ValidationError when the input is not valid
+// json, or when it fails one of the checks of the options.
+//
+//	err := gjson.ValidateWithOptions(json, gjson.ValidateOptions{
+//		DisallowDuplicateKeys: true,
+//		MaxDepth:              64,
+//	})
+func ValidateWithOptions(json string, opts ValidateOptions) error {
+	return ValidateBytesWithOptions(stringBytes(json), opts)
+}
+
+// ValidateBytesWithOptions returns a ValidationError when the input is not
+// valid json, or when it fails one of the checks of the options.
+//
+// If working with bytes, this method preferred over
+// ValidateWithOptions(string(data), opts)
+func ValidateBytesWithOptions(json []byte, opts ValidateOptions) error {
+	v := strictValidator{data: json, opts: opts}
+	i := v.space(0)
+	if i == len(json) {
+		return v.fail(i, "unexpected end of json")
+	}
+	if opts.DisallowScalars && json[i] != '{' && json[i] != '[' {
+		return v.fail(i, "json must be an object or an array")
+	}
+	i, err := v.any(i, 0)
+	if err != nil {
+		return err
+	}
+	if i = v.space(i); i < len(json) {
+		return v.fail(i, "invalid character after json")
+	}
+	return nil
+}
+
+// strictValidator validates json for ValidateWithOptions.
+type strictValidator struct {
+	data []byte
+	opts ValidateOptions
+}
+
+// fail returns a ValidationError.
+func (v *strictValidator) fail(i int, msg string) error {
+	return &ValidationError{Offset: i, Msg: msg}
+}
+
+// space skips whitespace.
+func (v *strictValidator) space(i int) int {
+	for ; i < len(v.data); i++ {
+		switch v.data[i] {
+		case ' ', '\t', '\n', '\r':
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// any validates the value that starts at i, which is not whitespace.
+func (v *strictValidator) any(i, depth int) (int, error) {
+	if i == len(v.data) {
+		return i, v.fail(i, "unexpected end of json")
+	}
+	var ok bool
+	var outi int
+	switch v.data[i] {
+	case '{', '[':
+		return v.container(i, depth+1)
+	case '"':
+		return v.string(i)
+	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		if outi, ok = validnumber(v.data, i+1); !ok {
+			return outi, v.fail(outi, "invalid number")
+		}
+		if v.opts.DisallowNumberOverflow {
+			f, _ := strconv.ParseFloat(bytesString(v.data[i:outi]), 64)
+			if math.IsInf(f, 0) {
+				return i, v.fail(i, "number is out of range")
+			}
+		}
+		return outi, nil
+	case 't':
+		outi, ok = validtrue(v.data, i+1)
+	case 'f':
+		outi, ok = validfalse(v.data, i+1)
+	case 'n':
+		outi, ok = validnull(v.data, i+1)
+	}
+	if !ok {
+		return i, v.fail(i, "invalid character")
+	}
+	return outi, nil
+}
+
+// container validates the object or array that starts at i.
+func (v *strictValidator) container(i, depth int) (int, error) {
+	if v.opts.MaxDepth > 0 && depth > v.opts.MaxDepth {
+		return i, v.fail(i, "json is nested too deeply")
+	}
+	obj := v.data[i] == '{'
+	end := byte(']')
+	if obj {
+		end = '}'
+	}
+	var keys map[string]bool
+	if obj && v.opts.DisallowDuplicateKeys {
+		keys = make(map[string]bool)
+	}
+	i = v.space(i + 1)
+	if i < len(v.data) && v.data[i] == end {
+		return i + 1, nil
+	}
+	for {
+		var err error
+		if obj {
+			if i == len(v.data) || v.data[i] != '"' {
+				return i, v.fail(i, "expected a key")
+			}
+			s := i
+			if i, err = v.string(i); err != nil {
+				return i, err
+			}
+			if keys != nil {
+				key := v.data[s+1 : i-1]
+				var name string
+				if bytes.IndexByte(key, '\\') == -1 {
+					name = string(key)
+				} else {
+					name = unescape(string(key))
+				}
+				if keys[name] {
+					return s, v.fail(s, "duplicate key "+strconv.Quote(name))
+				}
+				keys[name] = true
+			}
+			if i = v.space(i); i == len(v.data) || v.data[i] != ':' {
+				return i, v.fail(i, "expected a colon")
+			}
+			i = v.space(i + 1)
+		}
+		if i, err = v.any(i, depth); err != nil {
+			return i, err
+		}
+		i = v.space(i)
+		if i == len(v.data) {
+			return i, v.fail(i, "unexpected end of json")
+		}
+		switch v.data[i] {
+		case end:
+			return i + 1, nil
+		case ',':
+			i = v.space(i + 1)
+		default:
+			return i, v.fail(i, "expected a comma")
+		}
+	}
+}
+
+// string validates the string that starts at i.
+func (v *strictValidator) string(i int) (int, error) {
+	outi, ok := validstring(v.data, i+1)
+	if !ok {
+		return outi, v.fail(outi, "invalid string")
+	}
+	str := v.data[i+1 : outi-1]
+	if v.opts.DisallowInvalidUTF8 && !utf8.Valid(str) {
+		for j := 0; j < len(str); {
+			r, n := utf8.DecodeRune(str[j:])
+			if r == utf8.RuneError && n == 1 {
+				return i + 1 + j, v.fail(i+1+j, "invalid UTF-8")
+			}
+			j += n
+		}
+	}
+	if v.opts.DisallowLoneSurrogates {
+		for j := 0; j < len(str); j++ {
+			if str[j] != '\\' {
+				continue
+			}
+			j++
+			if str[j] != 'u' {
+				continue
+			}
+			r, _ := strconv.ParseUint(string(str[j+1:j+5]), 16, 16)
+			if utf16.IsSurrogate(rune(r)) {
+				// a high surrogate must be followed by a low surrogate
+				var r2 uint64
+				if r < 0xDC00 && j+10 < len(str) && str[j+5] == '\\' &&
+					str[j+6] == 'u' {
+					r2, _ = strconv.ParseUint(string(str[j+7:j+11]), 16, 16)
+				}
+				if r2 < 0xDC00 || r2 > 0xDFFF {
+					return i + j, v.fail(i+j, "lone surrogate")
+				}
+				j += 6
+			}
+			j += 4
+		}
+	}
+	return outi, nil
+}
+
 func parseUint(s string) (n uint64, ok bool) {
 	var i int
 	if i == len(s) {
@@ -2847,7 +3543,9 @@ func execStatic(json, path string) (pathOut, res string, ok bool) {
 
 // execModifier parses the path to find a matching modifier function.
 // The input expects that the path already starts with a '@'
-func execModifier(json, path string) (pathOut, res string, ok bool) {
+func (ev *evaluator) execModifier(json, path string) (
+	pathOut, res string, ok bool,
+) {
 	name := path[1:]
 	var hasArgs bool
 	for i := 1; i < len(path); i++ {
@@ -2868,7 +3566,7 @@ func execModifier(json, path string) (pathOut, res string, ok bool) {
 			break
 		}
 	}
-	if fn, ok := modifiers[name]; ok {
+	if fn, ok := ev.engine.modifier(name); ok {
 		var args string
 		if hasArgs {
 			var parsedArgs bool
@@ -2899,11 +3597,57 @@ func execModifier(json, path string) (pathOut, res string, ok bool) {
 				pathOut = pathOut[i:]
 			}
 		}
-		return pathOut, fn(json, args), true
+		res, err := ev.callModifier(name, fn, json, args, ev.valuePath(path))
+		if err != nil {
+			ev.err = err
+			return pathOut, "", true
+		}
+		return pathOut, res, true
 	}
 	return pathOut, res, false
 }
 
+// callModifier calls a modifier function, after checking the policy and the
+// limits of the engine. The path is the path of the json, for ModContext.
+// Errors of the modifier are returned as a ModifierError.
+func (ev *evaluator) callModifier(name string, fn ModifierFunc, json, args,
+	path string,
+) (string, error) {
+	if ev.engine.policy != nil && !ev.engine.allowed[name] {
+		return "", &PolicyError{Feature: "modifier", Name: name}
+	}
+	if ev.budget != nil {
+		if err := ev.budget.modifier(); err != nil {
+			return "", err
+		}
+	}
+	ctx := ModContext{Root: ev.root, Path: path, Engine: ev.engine,
+		budget: ev.budget}
+	if ev.budget != nil && ev.budget.ctx != nil {
+		ctx.Context = ev.budget.ctx
+	}
+	res, err := fn(ctx, json, args)
+	if err != nil {
+		var lerr *LimitError
+		var perr *PolicyError
+		if errors.As(err, &lerr) {
+			// limits are not the fault of the modifier
+			return "", lerr
+		} else if errors.As(err, &perr) {
+			return "", perr
+		} else if ev.budget.canceled(err) {
+			return "", err
+		}
+		return "", &ModifierError{Name: name, Err: err}
+	}
+	if ev.budget != nil {
+		if err := ev.budget.size(len(res)); err != nil {
+			return "", err
+		}
+	}
+	return res, nil
+}
+
 // unwrap removes the '[]' or '{}' characters around json
 func unwrap(json string) string {
 	json = trim(json)
@@ -2916,10 +3660,10 @@ func unwrap(json string) string {
 // DisableModifiers will disable the modifier syntax
 var DisableModifiers = false
 
-var modifiers map[string]func(json, arg string) string
-
-func init() {
-	modifiers = map[string]func(json, arg string) string{
+// builtinModifiers returns a new map of the built-in modifiers that cannot
+// fail.
+func builtinModifiers() map[string]func(json, arg string) string {
+	return map[string]func(json, arg string) string{
 		"pretty":  modPretty,
 		"ugly":    modUgly,
 		"reverse": modReverse,
@@ -2932,38 +3676,747 @@ func init() {
 		"tostr":   modToStr,
 		"fromstr": modFromStr,
 		"group":   modGroup,
-		"dig":     modDig,
 	}
 }
 
-// AddModifier binds a custom modifier command to the GJSON syntax.
-// This operation is not thread safe and should be executed prior to
-// using all other gjson function.
-func AddModifier(name string, fn func(json, arg string) string) {
-	modifiers[name] = fn
+// builtinModifierFuncs returns a new map of the built-in modifiers that use
+// a ModContext.
+func builtinModifierFuncs() map[string]ModifierFunc {
+	return map[string]ModifierFunc{
+		"dig":         modDig,
+		"sort":        modSort,
+		"sum":         modSum,
+		"avg":         modAvg,
+		"min":         modMin,
+		"max":         modMax,
+		"count":       modCount,
+		"unique":      modUnique,
+		"filter":      modFilter,
+		"map":         modMap,
+		"coalesce":    modCoalesce,
+		"groupby":     modGroupBy,
+		"slice":       modSlice,
+		"first":       modFirst,
+		"last":        modLast,
+		"skip":        modSkip,
+		"pick":        modPick,
+		"omit":        modOmit,
+		"rename":      modRename,
+		"entries":     modEntries,
+		"fromentries": modFromEntries,
+		"flattenobj":  modFlattenObj,
+		"unflatten":   modUnflatten,
+		"lower":       modLower,
+		"upper":       modUpper,
+		"replace":     modReplace,
+		"substr":      modSubstr,
+		"base64":      modBase64,
+		"unbase64":    modUnbase64,
+		"hex":         modHex,
+		"urlencode":   modURLEncode,
+		"urldecode":   modURLDecode,
+		"sha256":      modSHA256,
+		"md5":         modMD5,
+		"crc32":       modCRC32,
+		"type":        modType,
+		"len":         modLen,
+		"exists":      modExists,
+		"isnull":      modIsNull,
+		"zip":         modZip,
+		"chunk":       modChunk,
+		"window":      modWindow,
+		"trim":        modTrim,
+		"split":       modSplit,
+		"concat":      modConcat,
+		"default":     modDefault,
+	}
 }
 
-// ModifierExists returns true when the specified modifier exists.
-func ModifierExists(name string, fn func(json, arg string) string) bool {
-	_, ok := modifiers[name]
-	return ok
+// ModifierInfo describes a modifier.
+type ModifierInfo struct {
+	// Name is the name of the modifier, without the '@'.
+	Name string
+	// Description is a short summary of what the modifier does.
+	Description string
+	// Args are the options that the arg of the modifier may provide, as an
+	// object such as {"size":2}. Some modifiers also accept the value of
+	// the first option by itself, such as "@chunk:2".
+	Args []ModifierArg
+	// Positional is true when the arg is only the value of the first
+	// option, such as "@unique:id", and an object of options is not
+	// accepted.
+	Positional bool
+	// Builtin is true when the modifier is one of the built-in modifiers.
+	Builtin bool
 }
 
-// cleanWS remove any non-whitespace from string
-func cleanWS(s string) string {
-	for i := 0; i < len(s); i++ {
-		switch s[i] {
-		case ' ', '\t', '\n', '\r':
-			continue
-		default:
-			var s2 []byte
-			for i := 0; i < len(s); i++ {
-				switch s[i] {
-				case ' ', '\t', '\n', '\r':
-					s2 = append(s2, s[i])
-				}
-			}
-			return string(s2)
+// ModifierArg describes an option of a modifier arg.
+type ModifierArg struct {
+	// Name is the name of the option.
+	Name string
+	// Type is one of "string", "number", "bool", "array", "object", "path",
+	// or "any".
+	Type string
+	// Required is true when the option must be provided.
+	Required bool
+	// Description is a short summary of the option.
+	Description string
+}
+
+// builtinModifierInfos returns the descriptions of the built-in modifiers.
+func builtinModifierInfos() map[string]ModifierInfo {
+	byPath := []ModifierArg{
+		{Name: "path", Type: "path", Description: "path of each element to aggregate"},
+		{Name: "policy", Type: "string", Description: `"skip", "coerce", or "fail" for values that are not numbers`},
+	}
+	keys := []ModifierArg{
+		{Name: "keys", Type: "array", Required: true, Description: "keys of the members, which may contain wildcards"},
+		{Name: "deep", Type: "bool", Description: "also process nested objects"},
+	}
+	entries := []ModifierArg{
+		{Name: "key", Type: "string", Description: `field name of the key, "key" by default`},
+		{Name: "value", Type: "string", Description: `field name of the value, "value" by default`},
+	}
+	sep := []ModifierArg{
+		{Name: "sep", Type: "string", Description: "separator of the keys, a dot by default"},
+	}
+	n := func(desc string) []ModifierArg {
+		return []ModifierArg{{Name: "n", Type: "number", Description: desc}}
+	}
+	alphabet := []ModifierArg{
+		{Name: "encoding", Type: "string", Description: `"std", "url", "rawstd", or "rawurl"`},
+	}
+	return map[string]ModifierInfo{
+		"pretty": {Description: "Make the json document more human readable.",
+			Args: []ModifierArg{
+				{Name: "sortKeys", Type: "bool", Description: "sort the keys of objects"},
+				{Name: "indent", Type: "string", Description: "indentation of each level"},
+				{Name: "prefix", Type: "string", Description: "prefix of each line"},
+				{Name: "width", Type: "number", Description: "max width of single line arrays"},
+			}},
+		"ugly":    {Description: "Remove all whitespace from a json document."},
+		"reverse": {Description: "Reverse an array or the members of an object."},
+		"this":    {Description: "Returns the current element."},
+		"flatten": {Description: "Flattens an array.",
+			Args: []ModifierArg{
+				{Name: "deep", Type: "bool", Description: "flatten nested arrays"},
+			}},
+		"join": {Description: "Joins multiple objects into a single object.",
+			Args: []ModifierArg{
+				{Name: "preserve", Type: "bool", Description: "keep duplicate keys"},
+			}},
+		"valid":   {Description: "Ensure the json document is valid."},
+		"keys":    {Description: "Returns an array of keys for an object."},
+		"values":  {Description: "Returns an array of values for an object."},
+		"tostr":   {Description: "Converts json to a string."},
+		"fromstr": {Description: "Converts a string from json."},
+		"group":   {Description: "Groups arrays of objects."},
+		"dig": {Description: "Search for a value without providing its entire path.",
+			Args: []ModifierArg{
+				{Name: "path", Type: "path", Required: true, Description: "path to search for"},
+			}, Positional: true},
+		"sort": {Description: "Sort an array.",
+			Args: []ModifierArg{
+				{Name: "by", Type: "path", Description: "path, or array of paths, to sort by"},
+				{Name: "desc", Type: "bool", Description: "sort in descending order"},
+				{Name: "caseSensitive", Type: "bool", Description: "compare strings with case, true by default"},
+			}},
+		"sum": {Description: "Sum the numbers in an array.", Args: byPath},
+		"avg": {Description: "Average the numbers in an array.", Args: byPath},
+		"min": {Description: "Returns the smallest value in an array.", Args: byPath},
+		"max": {Description: "Returns the largest value in an array.", Args: byPath},
+		"count": {Description: "Count the elements in an array.",
+			Args: []ModifierArg{
+				{Name: "path", Type: "path", Description: "only count elements where the path is not null"},
+			}},
+		"unique": {Description: "Remove duplicate elements from an array.",
+			Args: []ModifierArg{
+				{Name: "path", Type: "path", Description: "path of each element to deduplicate by"},
+			}, Positional: true},
+		"slice": {Description: "Returns a range of array elements.",
+			Args: []ModifierArg{
+				{Name: "start", Type: "number", Description: "first position, which may be negative"},
+				{Name: "end", Type: "number", Description: "position after the last, which may be negative"},
+			}},
+		"first": {Description: "Take the first N array elements.", Args: n("number of elements")},
+		"last":  {Description: "Take the last N array elements.", Args: n("number of elements")},
+		"skip":  {Description: "Skip the first N array elements.", Args: n("number of elements")},
+		"map": {Description: "Apply a path to every element of an array or value of an object.",
+			Args: []ModifierArg{
+				{Name: "path", Type: "path", Required: true, Description: "path, or object of paths, to apply"},
+			}, Positional: true},
+		"filter": {Description: "Keep the array elements or object members that match a query.",
+			Args: []ModifierArg{
+				{Name: "value", Type: "string", Description: "query of each value"},
+				{Name: "key", Type: "string", Description: "query of each key or index"},
+			}},
+		"pick": {Description: "Keep object members by key.", Args: keys},
+		"omit": {Description: "Remove object members by key.", Args: keys},
+		"rename": {Description: "Rename object members.",
+			Args: []ModifierArg{
+				{Name: "keys", Type: "object", Required: true, Description: "new name of each key"},
+				{Name: "deep", Type: "bool", Description: "also rename nested objects"},
+			}},
+		"entries":     {Description: "Convert an object to an array of key/value entries.", Args: entries},
+		"fromentries": {Description: "Convert an array of key/value entries to an object.", Args: entries},
+		"flattenobj":  {Description: "Flatten nested objects and arrays into an object of paths.", Args: sep},
+		"unflatten":   {Description: "Rebuild nested json from an object of paths.", Args: sep},
+		"lower":       {Description: "Convert a string to lowercase."},
+		"upper":       {Description: "Convert a string to uppercase."},
+		"trim": {Description: "Trim the whitespace of a string.",
+			Args: []ModifierArg{
+				{Name: "cutset", Type: "string", Description: "characters to remove instead of whitespace"},
+			}, Positional: true},
+		"split": {Description: "Split a string into an array.",
+			Args: []ModifierArg{
+				{Name: "sep", Type: "string", Required: true, Description: "separator of the parts"},
+			}, Positional: true},
+		"replace": {Description: "Replace text in a string.",
+			Args: []ModifierArg{
+				{Name: "old", Type: "string", Required: true, Description: "text to replace"},
+				{Name: "new", Type: "string", Description: "replacement text"},
+				{Name: "n", Type: "number", Description: "max number of replacements"},
+			}},
+		"substr": {Description: "Take part of a string.",
+			Args: []ModifierArg{
+				{Name: "start", Type: "number", Description: "first character, which may be negative"},
+				{Name: "len", Type: "number", Description: "number of characters"},
+			}},
+		"concat": {Description: "Join the values of an array into a string.",
+			Args: []ModifierArg{
+				{Name: "sep", Type: "string", Description: "separator of the values"},
+			}, Positional: true},
+		"base64":    {Description: "Encode a value as base64.", Args: alphabet},
+		"unbase64":  {Description: "Decode a base64 string.", Args: alphabet},
+		"hex":       {Description: "Encode a value as hex."},
+		"urlencode": {Description: "Encode a value as url query text."},
+		"urldecode": {Description: "Decode url query text."},
+		"sha256":    {Description: "Hash a value with SHA-256."},
+		"md5":       {Description: "Hash a value with MD5."},
+		"crc32":     {Description: "Checksum a value with CRC-32."},
+		"type":      {Description: "Returns the type of a value."},
+		"len":       {Description: "Returns the length of a string, array, or object."},
+		"exists":    {Description: "Returns true when a value exists."},
+		"isnull":    {Description: "Returns true when a value is null."},
+		"default": {Description: "Returns the arg when a value is missing or null.",
+			Args: []ModifierArg{
+				{Name: "value", Type: "any", Required: true, Description: "value to use instead"},
+			}, Positional: true},
+		"coalesce": {Description: "Returns the value of the first path that exists.",
+			Args: []ModifierArg{
+				{Name: "paths", Type: "array", Required: true, Description: "paths to try in order"},
+			}},
+		"groupby": {Description: "Groups the elements of an array by a key and aggregates each group.",
+			Args: []ModifierArg{
+				{Name: "key", Type: "path", Description: "path of each element to group by"},
+				{Name: "agg", Type: "object", Description: "modifier of each output member"},
+			}},
+		"zip": {Description: "Combines an array of arrays into an array of tuples."},
+		"chunk": {Description: "Split an array into batches of N.",
+			Args: []ModifierArg{
+				{Name: "size", Type: "number", Required: true, Description: "number of elements in each batch"},
+			}},
+		"window": {Description: "Split an array into sliding windows.",
+			Args: []ModifierArg{
+				{Name: "size", Type: "number", Required: true, Description: "number of elements in each window"},
+				{Name: "step", Type: "number", Description: "distance between windows, 1 by default"},
+			}},
+	}
+}
+
+// Config is the configuration of an Engine.
+type Config struct {
+	// DisableModifiers disables the modifier syntax, such as "@reverse".
+	DisableModifiers bool
+	// DisableLiterals disables the literal syntax, such as "!true".
+	DisableLiterals bool
+
+	// The following limits stop an evaluation with a LimitError, and zero
+	// means no limit.
+
+	// MaxDepth is the maximum depth of nested paths, such as multipaths,
+	// queries, and the paths of modifiers, and of the nested arrays and
+	// objects that modifiers process.
+	MaxDepth int
+	// MaxResultSize is the maximum size, in bytes, of the result and of the
+	// json that multipaths and modifiers produce. The built-in modifiers
+	// stop as soon as their json is too large.
+	MaxResultSize int
+	// MaxModifiers is the maximum number of modifiers that are applied,
+	// including the modifiers of nested paths.
+	MaxModifiers int
+	// MaxSteps is the maximum number of steps, where a step is a path
+	// that is evaluated, a modifier that is applied, or an object member or
+	// array element that is scanned, including the values that modifiers
+	// process.
+	MaxSteps int
+
+	// Policy restricts the syntax of paths, which is useful for paths that
+	// come from untrusted users. A nil Policy allows all of the syntax.
+	Policy *Policy
+}
+
+// Policy restricts the syntax that paths may use. Paths that use syntax that
+// is not allowed stop with a PolicyError. The zero value only allows plain
+// paths, such as "name.last" and "friends.#.first".
+//
+//	e := gjson.NewEngine(gjson.Config{Policy: &gjson.Policy{
+//		Modifiers:     []string{"reverse", "keys", "values"},
+//		Queries:       true,
+//		MaxPathLength: 256,
+//	}})
+type Policy struct {
+	// Modifiers are the names of the modifiers that may be used.
+	Modifiers []string
+	// Literals allows the literal syntax, such as "!true".
+	Literals bool
+	// Multipaths allows the multipath syntax, such as "[name,age]".
+	Multipaths bool
+	// RecursiveSearch allows the @dig modifier to search for values in all
+	// of the nested objects and arrays. The modifier must also be allowed.
+	RecursiveSearch bool
+	// Queries allows the query syntax, such as "friends.#(age>40)", which
+	// includes the queries of the @filter modifier. The modifier must also
+	// be allowed.
+	Queries bool
+	// MaxPathLength is the maximum length of a path in bytes, and zero means
+	// no limit.
+	MaxPathLength int
+}
+
+// PolicyError is returned by GetE when a path uses syntax that is not
+// allowed by the Policy of the engine.
+type PolicyError struct {
+	// Feature is one of "modifier", "literals", "multipaths",
+	// "recursive search", "queries", or "path length".
+	Feature string
+	// Name is the name of the modifier, when the feature is "modifier".
+	Name string
+	// Max is the maximum path length, when the feature is "path length".
+	Max int
+}
+
+func (err *PolicyError) Error() string {
+	switch err.Feature {
+	case "modifier":
+		return "gjson: modifier @" + err.Name + " is not allowed"
+	case "path length":
+		return "gjson: path is longer than " + strconv.Itoa(err.Max) +
+			" bytes"
+	case "recursive search":
+		return "gjson: recursive search is not allowed"
+	}
+	return "gjson: " + err.Feature + " are not allowed"
+}
+
+// Engine evaluates paths using its own set of modifiers and configuration,
+// which allows for different modifiers to be used in isolation.
+// An Engine is safe for concurrent use, including adding modifiers.
+//
+// The package-level functions, such as Get and AddModifier, use a default
+// engine.
+type Engine struct {
+	config    Config
+	mu        sync.RWMutex
+	modifiers map[string]modifier
+	policy    *Policy
+	allowed   map[string]bool // modifiers allowed by the policy
+}
+
+// modifier is a modifier that is bound to an engine.
+type modifier struct {
+	fn   ModifierFunc
+	info ModifierInfo
+}
+
+// defaultEngine is used by the package-level functions.
+var defaultEngine *Engine
+
+func init() {
+	defaultEngine = NewEngine(Config{})
+}
+
+// NewEngine returns a new engine that has the built-in modifiers.
+func NewEngine(config Config) *Engine {
+	e := &Engine{config: config, modifiers: make(map[string]modifier)}
+	if config.Policy != nil {
+		// copy the policy, so that it cannot change while in use
+		policy := *config.Policy
+		policy.Modifiers = append([]string(nil), policy.Modifiers...)
+		e.policy = &policy
+		e.config.Policy = &policy
+		e.allowed = make(map[string]bool)
+		for _, name := range policy.Modifiers {
+			e.allowed[name] = true
+		}
+	}
+	funcs := builtinModifierFuncs()
+	for name, fn := range builtinModifiers() {
+		funcs[name] = walkFunc(fn)
+	}
+	infos := builtinModifierInfos()
+	for name, fn := range funcs {
+		info := infos[name]
+		info.Name = name
+		info.Builtin = true
+		e.modifiers[name] = modifier{fn: fn, info: info}
+	}
+	return e
+}
+
+// Config returns the configuration of the engine.
+func (e *Engine) Config() Config {
+	config := e.config
+	if config.Policy != nil {
+		policy := *config.Policy
+		policy.Modifiers = append([]string(nil), policy.Modifiers...)
+		config.Policy = &policy
+	}
+	return config
+}
+
+// checkPolicy returns a PolicyError when the policy of the engine does not
+// allow a feature.
+func (e *Engine) checkPolicy(feature string) error {
+	p := e.policy
+	if p == nil {
+		return nil
+	}
+	var ok bool
+	switch feature {
+	case "literals":
+		ok = p.Literals
+	case "multipaths":
+		ok = p.Multipaths
+	case "recursive search":
+		ok = p.RecursiveSearch
+	case "queries":
+		ok = p.Queries
+	}
+	if ok {
+		return nil
+	}
+	return &PolicyError{Feature: feature}
+}
+
+// modifiersDisabled returns true when the modifier syntax is disabled.
+// The default engine also uses the DisableModifiers variable.
+func (e *Engine) modifiersDisabled() bool {
+	return e.config.DisableModifiers || (e == defaultEngine && DisableModifiers)
+}
+
+// modifier returns the modifier with the specified name.
+func (e *Engine) modifier(name string) (ModifierFunc, bool) {
+	e.mu.RLock()
+	mod, ok := e.modifiers[name]
+	e.mu.RUnlock()
+	return mod.fn, ok
+}
+
+// AddModifier binds a custom modifier command to the GJSON syntax of the
+// engine. This operation is safe to call while other goroutines are using
+// the engine.
+func (e *Engine) AddModifier(name string, fn func(json, arg string) string) {
+	e.AddModifierFunc(name, modifierFunc(fn))
+}
+
+// AddModifierFunc binds a custom modifier command, which may return an
+// error, to the GJSON syntax of the engine. This operation is safe to call
+// while other goroutines are using the engine.
+func (e *Engine) AddModifierFunc(name string, fn ModifierFunc) {
+	e.AddModifierInfo(ModifierInfo{Name: name}, fn)
+}
+
+// AddModifierInfo binds a custom modifier command, along with its
+// documentation, to the GJSON syntax of the engine. The name of the
+// modifier is info.Name, and info.Builtin is ignored.
+func (e *Engine) AddModifierInfo(info ModifierInfo, fn ModifierFunc) {
+	info.Builtin = false
+	info.Args = append([]ModifierArg(nil), info.Args...)
+	e.mu.Lock()
+	e.modifiers[info.Name] = modifier{fn: fn, info: info}
+	e.mu.Unlock()
+}
+
+// RemoveModifier unbinds a modifier command, including a built-in one, from
+// the GJSON syntax of the engine.
+func (e *Engine) RemoveModifier(name string) {
+	e.mu.Lock()
+	delete(e.modifiers, name)
+	e.mu.Unlock()
+}
+
+// ModifierExists returns true when the specified modifier exists.
+func (e *Engine) ModifierExists(name string) bool {
+	_, ok := e.modifier(name)
+	return ok
+}
+
+// Modifiers returns the descriptions of the modifiers of the engine, sorted
+// by name.
+func (e *Engine) Modifiers() []ModifierInfo {
+	e.mu.RLock()
+	infos := make([]ModifierInfo, 0, len(e.modifiers))
+	for _, mod := range e.modifiers {
+		info := mod.info
+		info.Args = append([]ModifierArg(nil), info.Args...)
+		infos = append(infos, info)
+	}
+	e.mu.RUnlock()
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// AddModifier binds a custom modifier command to the GJSON syntax.
+// This operation is safe to call while other goroutines are using gjson.
+func AddModifier(name string, fn func(json, arg string) string) {
+	defaultEngine.AddModifier(name, fn)
+}
+
+// AddModifierFunc binds a custom modifier command, which may return an
+// error, to the GJSON syntax. The error is returned by GetE.
+// This operation is safe to call while other goroutines are using gjson.
+//
+//	gjson.AddModifierFunc("must", func(ctx gjson.ModContext, json, arg string) (string, error) {
+//		if !gjson.Parse(json).Exists() {
+//			return "", errors.New("missing value")
+//		}
+//		return json, nil
+//	})
+func AddModifierFunc(name string, fn ModifierFunc) {
+	defaultEngine.AddModifierFunc(name, fn)
+}
+
+// AddModifierInfo binds a custom modifier command, along with its
+// documentation, to the GJSON syntax. The documentation is returned by
+// Modifiers.
+//
+//	gjson.AddModifierInfo(gjson.ModifierInfo{
+//		Name:        "must",
+//		Description: "Fail when a value is missing.",
+//	}, must)
+func AddModifierInfo(info ModifierInfo, fn ModifierFunc) {
+	defaultEngine.AddModifierInfo(info, fn)
+}
+
+// RemoveModifier unbinds a modifier command, including a built-in one, from
+// the GJSON syntax.
+func RemoveModifier(name string) {
+	defaultEngine.RemoveModifier(name)
+}
+
+// ModifierExists returns true when the specified modifier exists.
+// The fn param is not used, and is only kept for compatibility.
+func ModifierExists(name string, fn func(json, arg string) string) bool {
+	return defaultEngine.ModifierExists(name)
+}
+
+// Modifiers returns the descriptions of the modifiers, sorted by name.
+func Modifiers() []ModifierInfo {
+	return defaultEngine.Modifiers()
+}
+
+// ModifierFunc is a modifier that receives the context of the evaluation
+// and can return an error. The error stops the evaluation and is returned
+// by GetE.
+type ModifierFunc func(ctx ModContext, json, arg string) (string, error)
+
+// modifierFunc converts a modifier that cannot fail into a ModifierFunc.
+func modifierFunc(fn func(json, arg string) string) ModifierFunc {
+	return func(_ ModContext, json, arg string) (string, error) {
+		return fn(json, arg), nil
+	}
+}
+
+// walkFunc converts a built-in modifier that cannot fail into a
+// ModifierFunc, which uses the budget of the evaluation for all of the json
+// before calling the modifier.
+func walkFunc(fn func(json, arg string) string) ModifierFunc {
+	return func(ctx ModContext, json, arg string) (string, error) {
+		if err := ctx.walk(Parse(json)); err != nil {
+			return "", err
+		}
+		return fn(json, arg), nil
+	}
+}
+
+// ModContext is the context of a modifier call.
+type ModContext struct {
+	// Root is the json that the evaluation started with, which is the json
+	// that was passed to ModContext.Get for the paths that a modifier
+	// evaluates.
+	Root string
+	// Path is the path of the json that the modifier receives, which returns
+	// the json when it's evaluated on Root, such as "friends.1.name" for
+	// "friends.#.name.@upper". It's "@this" for the root and empty when the
+	// json does not come from a path, such as the groups of @groupby.
+	Path string
+	// Engine is the engine that is evaluating the path. Use Engine.Config
+	// for its settings.
+	Engine *Engine
+	// Context is the context of an evaluation that was started with
+	// GetContext, otherwise it's nil. Long running modifiers should stop
+	// when it's done.
+	Context context.Context
+
+	budget *budget
+}
+
+// engine returns the engine of the context, or the default engine.
+func (ctx ModContext) engine() *Engine {
+	if ctx.Engine == nil {
+		return defaultEngine
+	}
+	return ctx.Engine
+}
+
+// Get searches json for the specified path using the same engine as the
+// evaluation, and returns the first error that was returned by a modifier.
+func (ctx ModContext) Get(json, path string) (Result, error) {
+	ev := evaluator{engine: ctx.engine(), root: json, path: path,
+		budget: ctx.budget}
+	res := ev.get(json, path)
+	if ev.err != nil {
+		return Result{}, ev.err
+	}
+	return res, nil
+}
+
+// callModifier calls the modifier of the engine with the specified name,
+// with the same policy and limit checks as a modifier in a path. It returns
+// false when there's no such modifier.
+func (ctx ModContext) callModifier(name, json, arg string) (string, bool,
+	error,
+) {
+	fn, ok := ctx.engine().modifier(name)
+	if !ok {
+		return "", false, nil
+	}
+	ev := evaluator{engine: ctx.engine(), root: ctx.Root, budget: ctx.budget}
+	res, err := ev.callModifier(name, fn, json, arg, "")
+	return res, true, err
+}
+
+// step uses one step of the budget of the evaluation.
+func (ctx ModContext) step() error {
+	if ctx.budget == nil {
+		return nil
+	}
+	return ctx.budget.step()
+}
+
+// enter increases the depth of the evaluation for a nested value that a
+// modifier processes. When no error is returned, leave must be called.
+func (ctx ModContext) enter() error {
+	if ctx.budget == nil {
+		return nil
+	}
+	return ctx.budget.enter()
+}
+
+// leave decreases the depth of the evaluation.
+func (ctx ModContext) leave() {
+	if ctx.budget != nil {
+		ctx.budget.leave()
+	}
+}
+
+// size checks the size of the json that a modifier is building, so that it
+// stops before all of the json is built.
+func (ctx ModContext) size(n int) error {
+	if ctx.budget == nil {
+		return nil
+	}
+	return ctx.budget.size(n)
+}
+
+// walk uses the budget of the evaluation for a value and all of its nested
+// values, for a modifier that processes the whole value.
+func (ctx ModContext) walk(res Result) error {
+	if ctx.budget == nil {
+		return nil
+	}
+	return ctx.budget.walk(res)
+}
+
+// forEach iterates over the elements of an array, or the members of an
+// object, using one step of the budget for each. The first error that is
+// returned by iter stops the iteration and is returned.
+func (ctx ModContext) forEach(res Result,
+	iter func(key, value Result) error,
+) error {
+	var err error
+	res.ForEach(func(key, value Result) bool {
+		if ctx.budget != nil {
+			if err = ctx.budget.step(); err != nil {
+				return false
+			}
+		}
+		err = iter(key, value)
+		return err == nil
+	})
+	return err
+}
+
+// array returns the elements of an array like Result.Array, using one step
+// of the budget for each.
+func (ctx ModContext) array(res Result) ([]Result, error) {
+	if ctx.budget == nil || !res.IsArray() {
+		return res.Array(), nil
+	}
+	var values []Result
+	err := ctx.forEach(res, func(_, value Result) error {
+		values = append(values, value)
+		return nil
+	})
+	return values, err
+}
+
+// ModifierError is returned by GetE when a modifier fails.
+type ModifierError struct {
+	Name string // name of the modifier, without the '@'
+	Err  error  // error returned by the modifier
+}
+
+func (err *ModifierError) Error() string {
+	// the errors of ParseArgs already have the prefix
+	msg := strings.TrimPrefix(err.Err.Error(), "gjson: ")
+	return "gjson: @" + err.Name + ": " + msg
+}
+
+func (err *ModifierError) Unwrap() error {
+	return err.Err
+}
+
+// LimitError is returned by GetE when an evaluation exceeds one of the
+// limits of the engine, such as Config.MaxSteps.
+type LimitError struct {
+	Limit string // "depth", "result size", "modifiers", or "steps"
+	Max   int    // the configured limit
+}
+
+func (err *LimitError) Error() string {
+	return "gjson: " + err.Limit + " limit of " + strconv.Itoa(err.Max) +
+		" exceeded"
+}
+
+// cleanWS remove any non-whitespace from string
+func cleanWS(s string) string {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case ' ', '\t', '\n', '\r':
+			continue
+		default:
+			var s2 []byte
+			for i := 0; i < len(s); i++ {
+				switch s[i] {
+				case ' ', '\t', '\n', '\r':
+					s2 = append(s2, s[i])
+				}
+			}
+			return string(s2)
 		}
 	}
 	return s
@@ -3269,18 +4722,24 @@ func modGroup(json, arg string) string {
 		})
 		return true
 	})
-	var data []byte
-	data = append(data, '[')
-	for i, item := range all {
+	return string(appendGroups(nil, all))
+}
+
+// appendGroups appends an array of objects, one for each group. Each group
+// is a series of ",key:value" members.
+func appendGroups(dst []byte, groups [][]byte) []byte {
+	dst = append(dst, '[')
+	for i, item := range groups {
 		if i > 0 {
-			data = append(data, ',')
+			dst = append(dst, ',')
+		}
+		dst = append(dst, '{')
+		if len(item) > 0 {
+			dst = append(dst, item[1:]...)
 		}
-		data = append(data, '{')
-		data = append(data, item[1:]...)
-		data = append(data, '}')
+		dst = append(dst, '}')
 	}
-	data = append(data, ']')
-	return string(data)
+	return append(dst, ']')
 }
 
 // stringHeader instead of reflect.StringHeader
@@ -3299,11 +4758,12 @@ type sliceHeader struct {
 // getBytes casts the input json bytes to a string and safely returns the
 // results as uniquely allocated data. This operation is intended to minimize
 // copies and allocations for the large json string->[]byte.
-func getBytes(json []byte, path string) Result {
+func getBytes(e *Engine, json []byte, path string) (Result, error) {
 	var result Result
+	var err error
 	if json != nil {
 		// unsafe cast to string
-		result = Get(*(*string)(unsafe.Pointer(&json)), path)
+		result, err = e.GetE(*(*string)(unsafe.Pointer(&json)), path)
 		// safely get the string headers
 		rawhi := *(*stringHeader)(unsafe.Pointer(&result.Raw))
 		strhi := *(*stringHeader)(unsafe.Pointer(&result.Str))
@@ -3340,7 +4800,7 @@ func getBytes(json []byte, path string) Result {
 			result.Str = string(*(*[]byte)(unsafe.Pointer(&strh)))
 		}
 	}
-	return result
+	return result, err
 }
 
 // fillIndex finds the position of Raw data and assigns it to the Index field
@@ -3582,21 +5042,39 @@ func Escape(comp string) string {
 	return comp
 }
 
-func parseRecursiveDescent(all []Result, parent Result, path string) []Result {
-	if res := parent.Get(path); res.Exists() {
+func parseRecursiveDescent(ctx ModContext, all []Result, parent Result,
+	path string,
+) ([]Result, error) {
+	if ctx.budget != nil {
+		if err := ctx.budget.enter(); err != nil {
+			return nil, err
+		}
+		defer ctx.budget.leave()
+	}
+	res, err := ctx.Get(parent.Raw, path)
+	if err != nil {
+		return nil, err
+	}
+	if res.Exists() {
 		all = append(all, res)
 	}
 	if parent.IsArray() || parent.IsObject() {
 		parent.ForEach(func(_, val Result) bool {
-			all = parseRecursiveDescent(all, val, path)
-			return true
+			all, err = parseRecursiveDescent(ctx, all, val, path)
+			return err == nil
 		})
 	}
-	return all
+	return all, err
 }
 
-func modDig(json, arg string) string {
-	all := parseRecursiveDescent(nil, Parse(json), arg)
+func modDig(ctx ModContext, json, arg string) (string, error) {
+	if err := ctx.engine().checkPolicy("recursive search"); err != nil {
+		return "", err
+	}
+	all, err := parseRecursiveDescent(ctx, nil, Parse(json), arg)
+	if err != nil {
+		return "", err
+	}
 	var out []byte
 	out = append(out, '[')
 	for i, res := range all {
@@ -3604,9 +5082,2365 @@ func modDig(json, arg string) string {
 			out = append(out, ',')
 		}
 		out = append(out, res.Raw...)
+		if err := ctx.size(len(out)); err != nil {
+			return "", err
+		}
+	}
+	out = append(out, ']')
+	return string(out), nil
+}
+
+// @sort sorts the elements of an array.
+//
+//	[3,1,2] -> [1,2,3]
+//
+// The {"by":"age"} arg sorts an array of objects by the value at a path.
+// Multiple paths may be provided, such as {"by":["last","first"]}, where each
+// path breaks ties of the previous one. The "desc" option reverses the order
+// and "caseSensitive":false compares strings without case.
+//
+// Elements are ordered using Result.Less and the sort is stable.
+// The original json is returned when the json is not an array.
+func modSort(ctx ModContext, json, arg string) (string, error) {
+	args := struct {
+		By            []string `gjson:"by"`
+		Desc          bool     `gjson:"desc"`
+		CaseSensitive bool     `gjson:"caseSensitive"`
+	}{CaseSensitive: true}
+	if err := ParseArgs(arg, &args); err != nil {
+		return "", err
+	}
+	res := Parse(json)
+	if !res.IsArray() {
+		return json, nil
+	}
+	by, desc, caseSensitive := args.By, args.Desc, args.CaseSensitive
+	type sortItem struct {
+		value Result
+		keys  []Result
+	}
+	var items []sortItem
+	err := ctx.forEach(res, func(_, value Result) error {
+		item := sortItem{value: value}
+		if len(by) == 0 {
+			item.keys = []Result{value}
+		} else {
+			item.keys = make([]Result, len(by))
+			for i, path := range by {
+				var err error
+				item.keys[i], err = ctx.Get(value.Raw, path)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i].keys, items[j].keys
+		for k := range a {
+			if a[k].Less(b[k], caseSensitive) {
+				return !desc
+			}
+			if b[k].Less(a[k], caseSensitive) {
+				return desc
+			}
+		}
+		return false
+	})
+	out := make([]byte, 0, len(json))
+	out = append(out, '[')
+	for i, item := range items {
+		if i > 0 {
+			out = append(out, ',')
+		}
+		out = append(out, item.value.Raw...)
 	}
 	out = append(out, ']')
-	return string(out)
+	return bytesString(out), nil
+}
+
+// aggArgs are the args of the aggregation modifiers.
+type aggArgs struct {
+	Path   string `gjson:"path"`
+	Policy string `gjson:"policy"`
+}
+
+func (args *aggArgs) Validate() error {
+	switch args.Policy {
+	case "", "skip", "coerce", "fail":
+		return nil
+	}
+	return errors.New(`gjson: arg "policy" must be "skip", "coerce", or "fail"`)
+}
+
+// parseAggArgs parses the arg of an aggregation modifier. The arg may be a
+// path that is applied to each array element, or an object with "path" and
+// "policy" options.
+func parseAggArgs(arg string) (args aggArgs, err error) {
+	if len(arg) > 0 && arg[0] == '{' && Valid(arg) {
+		err = ParseArgs(arg, &args)
+		return args, err
+	}
+	args.Path = arg
+	return args, nil
+}
+
+// aggNumbers collects the numbers of an array for the aggregation modifiers.
+// The policy decides what happens to non-numeric values: "skip" (default)
+// ignores them, "coerce" converts them using Result.Float, and "fail" causes
+// the modifier to return nothing. Missing values are always ignored, and
+// coerced values that are not finite numbers become 0. When mixed is set
+// and there's no policy, the values that are not null are all kept.
+func aggNumbers(ctx ModContext, json, arg string, mixed bool) (nums []Result,
+	ok bool, err error,
+) {
+	args, err := parseAggArgs(arg)
+	if err != nil {
+		return nil, false, err
+	}
+	res := Parse(json)
+	if !res.IsArray() {
+		return nil, false, nil
+	}
+	path, policy := args.Path, args.Policy
+	// errFail stops the iteration for the "fail" policy
+	errFail := errors.New("fail")
+	err = ctx.forEach(res, func(_, value Result) error {
+		if path != "" {
+			var err error
+			value, err = ctx.Get(value.Raw, path)
+			if err != nil {
+				return err
+			}
+			if !value.Exists() {
+				return nil
+			}
+		}
+		if value.Type != Number {
+			switch {
+			case policy == "coerce":
+				num := value.Float()
+				if math.IsNaN(num) || math.IsInf(num, 0) {
+					num = 0
+				}
+				value = Result{Type: Number, Num: num,
+					Raw: string(appendFloat(nil, num))}
+			case policy == "fail":
+				return errFail
+			case policy == "" && mixed && value.Type != Null:
+				// compared using Result.Less
+			default:
+				return nil
+			}
+		}
+		nums = append(nums, value)
+		return nil
+	})
+	if err == errFail {
+		return nil, false, nil
+	}
+	return nums, err == nil, err
+}
+
+// aggResult returns the json of a computed number, which is null when the
+// number is not finite, such as the sum of numbers that overflow.
+func aggResult(num float64) string {
+	if math.IsNaN(num) || math.IsInf(num, 0) {
+		return "null"
+	}
+	return string(appendFloat(nil, num))
+}
+
+// appendFloat appends the shortest json of a finite number, which uses an
+// exponent when the number is very small or very large, like JavaScript.
+func appendFloat(dst []byte, num float64) []byte {
+	abs := math.Abs(num)
+	if abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		return strconv.AppendFloat(dst, num, 'e', -1, 64)
+	}
+	return strconv.AppendFloat(dst, num, 'f', -1, 64)
+}
+
+// @sum returns the sum of the numbers in an array.
+//
+//	[1,2,3] -> 6
+//
+// The arg may be a path for each element, such as "orders.@sum:total", or an
+// object like {"path":"total","policy":"coerce"}. The "policy" option is one
+// of "skip", "coerce", or "fail" and decides what to do with non-numeric
+// values. The result is null when the sum overflows.
+func modSum(ctx ModContext, json, arg string) (string, error) {
+	nums, ok, err := aggNumbers(ctx, json, arg, false)
+	if !ok {
+		return "", err
+	}
+	var sum float64
+	for _, num := range nums {
+		sum += num.Num
+	}
+	return aggResult(sum), nil
+}
+
+// @avg returns the average of the numbers in an array, or null when there are
+// no numbers. It accepts the same arg as @sum.
+//
+//	[1,2,3] -> 2
+func modAvg(ctx ModContext, json, arg string) (string, error) {
+	nums, ok, err := aggNumbers(ctx, json, arg, false)
+	if !ok {
+		return "", err
+	}
+	if len(nums) == 0 {
+		return "null", nil
+	}
+	var sum float64
+	for _, num := range nums {
+		sum += num.Num
+	}
+	if math.IsInf(sum, 0) {
+		// the sum overflows, so use a running average instead
+		var avg float64
+		for i, num := range nums {
+			avg += (num.Num - avg) / float64(i+1)
+		}
+		return aggResult(avg), nil
+	}
+	return aggResult(sum / float64(len(nums))), nil
+}
+
+// @min returns the smallest value in an array, or null when there are no
+// values. Values are compared using Result.Less, where numbers are less than
+// strings, and null values are ignored. It accepts the same arg as @sum, and
+// with a "policy" only numbers are compared.
+//
+//	[3,1,2] -> 1
+//	["b","a"] -> "a"
+func modMin(ctx ModContext, json, arg string) (string, error) {
+	nums, ok, err := aggNumbers(ctx, json, arg, true)
+	if !ok {
+		return "", err
+	}
+	if len(nums) == 0 {
+		return "null", nil
+	}
+	least := nums[0]
+	for _, num := range nums[1:] {
+		if num.Less(least, true) {
+			least = num
+		}
+	}
+	return least.Raw, nil
+}
+
+// @max returns the largest value in an array, or null when there are no
+// values. Values are compared using Result.Less, where numbers are less than
+// strings, and null values are ignored. It accepts the same arg as @sum, and
+// with a "policy" only numbers are compared.
+//
+//	[3,1,2] -> 3
+//	[1,"a"] -> "a"
+func modMax(ctx ModContext, json, arg string) (string, error) {
+	nums, ok, err := aggNumbers(ctx, json, arg, true)
+	if !ok {
+		return "", err
+	}
+	if len(nums) == 0 {
+		return "null", nil
+	}
+	most := nums[0]
+	for _, num := range nums[1:] {
+		if most.Less(num, true) {
+			most = num
+		}
+	}
+	return most.Raw, nil
+}
+
+// @count returns the number of elements in an array. When a path is provided
+// as the arg, only the elements where the path exists and is not null are
+// counted.
+//
+//	[{"a":1},{"a":null},{}] -> 3
+//	@count:a -> 1
+func modCount(ctx ModContext, json, arg string) (string, error) {
+	args, err := parseAggArgs(arg)
+	if err != nil {
+		return "", err
+	}
+	res := Parse(json)
+	if !res.IsArray() {
+		return "", nil
+	}
+	path := args.Path
+	var n int
+	err = ctx.forEach(res, func(_, value Result) error {
+		if path != "" {
+			var err error
+			value, err = ctx.Get(value.Raw, path)
+			if err != nil {
+				return err
+			}
+			if !value.Exists() || value.Type == Null {
+				return nil
+			}
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(n), nil
+}
+
+// appendCanonicalNumber appends the canonical form of a number. A number
+// that is the same as its float64 value is formatted like appendFloat, and
+// other numbers keep all of their digits, such as 9007199254740993, which
+// is not a float64.
+func appendCanonicalNumber(dst []byte, t Result) []byte {
+	digits, exp, neg, ok := decimalParts(t.Raw)
+	if !ok {
+		if math.IsNaN(t.Num) || math.IsInf(t.Num, 0) {
+			return append(dst, "null"...)
+		}
+		return appendFloat(dst, t.Num)
+	}
+	if len(digits) == 0 {
+		return append(dst, '0')
+	}
+	if !math.IsInf(t.Num, 0) {
+		fdigits, fexp, _, _ := decimalParts(
+			strconv.FormatFloat(t.Num, 'e', -1, 64))
+		if fdigits == digits && fexp == exp {
+			return appendFloat(dst, t.Num)
+		}
+	}
+	if neg {
+		dst = append(dst, '-')
+	}
+	if exp >= 0 && len(digits)+exp <= 21 {
+		dst = append(dst, digits...)
+		for i := 0; i < exp; i++ {
+			dst = append(dst, '0')
+		}
+		return dst
+	}
+	dst = append(dst, digits[0])
+	if len(digits) > 1 {
+		dst = append(dst, '.')
+		dst = append(dst, digits[1:]...)
+	}
+	dst = append(dst, 'e')
+	if exp+len(digits)-1 >= 0 {
+		dst = append(dst, '+')
+	}
+	return strconv.AppendInt(dst, int64(exp+len(digits)-1), 10)
+}
+
+// decimalParts returns the significant digits of a json number, without
+// leading or trailing zeros, and the exponent of the last digit, such as
+// "15" and 1 for 1.50e2. The digits are empty when the number is zero.
+func decimalParts(raw string) (digits string, exp int, neg, ok bool) {
+	if len(raw) > 0 && raw[0] == '-' {
+		neg = true
+		raw = raw[1:]
+	}
+	isDigit := func(i int) bool {
+		return i < len(raw) && raw[i] >= '0' && raw[i] <= '9'
+	}
+	i := 0
+	for isDigit(i) {
+		i++
+	}
+	if i == 0 {
+		return "", 0, false, false
+	}
+	ipart, fpart := raw[:i], ""
+	if i < len(raw) && raw[i] == '.' {
+		j := i + 1
+		for isDigit(j) {
+			j++
+		}
+		if j == i+1 {
+			return "", 0, false, false
+		}
+		fpart = raw[i+1 : j]
+		i = j
+	}
+	if i < len(raw) && (raw[i] == 'e' || raw[i] == 'E') {
+		var err error
+		if exp, err = strconv.Atoi(raw[i+1:]); err != nil {
+			return "", 0, false, false
+		}
+		i = len(raw)
+	}
+	if i != len(raw) {
+		return "", 0, false, false
+	}
+	digits = strings.TrimLeft(ipart+fpart, "0")
+	exp -= len(fpart)
+	n := len(digits)
+	digits = strings.TrimRight(digits, "0")
+	return digits, exp + n - len(digits), neg, true
+}
+
+// appendCanonical appends the canonical form of a value. Values that are
+// semantically equal have the same canonical form, such as 1 and 1.0, or
+// {"a":1,"b":2} and {"b":2,"a":1}. Object members are ordered by key,
+// strings are re-escaped, and numbers use appendCanonicalNumber.
+func appendCanonical(dst []byte, t Result) []byte {
+	switch t.Type {
+	default:
+		return append(dst, "null"...)
+	case False:
+		return append(dst, "false"...)
+	case True:
+		return append(dst, "true"...)
+	case Number:
+		return appendCanonicalNumber(dst, t)
+	case String:
+		return AppendJSONString(dst, t.Str)
+	case JSON:
+	}
+	if t.IsArray() {
+		dst = append(dst, '[')
+		var i int
+		t.ForEach(func(_, value Result) bool {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = appendCanonical(dst, value)
+			i++
+			return true
+		})
+		return append(dst, ']')
+	}
+	var keys []string
+	var values []Result
+	t.ForEach(func(key, value Result) bool {
+		keys = append(keys, key.Str)
+		values = append(values, value)
+		return true
+	})
+	idxs := make([]int, len(keys))
+	for i := range idxs {
+		idxs[i] = i
+	}
+	sort.SliceStable(idxs, func(i, j int) bool {
+		return keys[idxs[i]] < keys[idxs[j]]
+	})
+	dst = append(dst, '{')
+	for i, idx := range idxs {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = AppendJSONString(dst, keys[idx])
+		dst = append(dst, ':')
+		dst = appendCanonical(dst, values[idx])
+	}
+	return append(dst, '}')
+}
+
+// @unique removes duplicate elements from an array, keeping the first
+// occurrence of each element.
+//
+//	[1,2,1.0,3,2] -> [1,2,3]
+//
+// A path may be provided as the arg to keep the first element for each
+// distinct value at that path.
+//
+//	[{"id":1,"n":"a"},{"id":1,"n":"b"}] -> [{"id":1,"n":"a"}]
+//
+// Elements are compared semantically, so 1 and 1.0 are equal, and so are
+// objects with the same members in a different order. Numbers are compared
+// exactly, including large integers that are not a float64. An element where
+// the path does not exist is not the same as one where it's null, and only
+// the first element without the path is kept.
+// The original json is returned when the json is not an array.
+func modUnique(ctx ModContext, json, arg string) (string, error) {
+	res := Parse(json)
+	if !res.IsArray() {
+		return json, nil
+	}
+	seen := make(map[string]bool)
+	var key []byte
+	out := make([]byte, 0, len(json))
+	out = append(out, '[')
+	var i int
+	err := ctx.forEach(res, func(_, value Result) error {
+		kval := value
+		if arg != "" {
+			var err error
+			if kval, err = ctx.Get(value.Raw, arg); err != nil {
+				return err
+			}
+		}
+		if err := ctx.walk(kval); err != nil {
+			return err
+		}
+		// the key of a missing value is empty, which is not null
+		key = key[:0]
+		if kval.Exists() {
+			key = appendCanonical(key, kval)
+		}
+		if seen[string(key)] {
+			return nil
+		}
+		seen[string(key)] = true
+		if i > 0 {
+			out = append(out, ',')
+		}
+		out = append(out, value.Raw...)
+		i++
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	out = append(out, ']')
+	return bytesString(out), nil
+}
+
+// appendRawArray appends an array made from the raw bytes of the values.
+func appendRawArray(dst []byte, values []Result) []byte {
+	dst = append(dst, '[')
+	for i, value := range values {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = append(dst, value.Raw...)
+	}
+	return append(dst, ']')
+}
+
+// sliceArray returns the raw array elements from start to end. Negative
+// positions are relative to the end of the array, and out of range positions
+// are clamped.
+func sliceArray(ctx ModContext, json string, start, end int) (string, error) {
+	values, err := ctx.array(Parse(json))
+	if err != nil {
+		return "", err
+	}
+	n := len(values)
+	if start < 0 {
+		start += n
+	}
+	if end < 0 {
+		end += n
+	}
+	start = max(0, min(start, n))
+	end = max(start, min(end, n))
+	return bytesString(appendRawArray(nil, values[start:end])), nil
+}
+
+// countArg parses the N arg of @first, @last, and @skip.
+func countArg(arg string, def int) (int, error) {
+	args := struct {
+		N int `gjson:"n,min=0"`
+	}{N: def}
+	err := ParseArgs(arg, &args)
+	return args.N, err
+}
+
+// @slice returns the elements of an array from "start" up to, but not
+// including, "end". Negative positions are relative to the end of the array.
+//
+//	@slice:{"start":1,"end":3}: [1,2,3,4,5] -> [2,3]
+//	@slice:{"start":-2}: [1,2,3,4,5] -> [4,5]
+//
+// The original json is returned when the json is not an array.
+func modSlice(ctx ModContext, json, arg string) (string, error) {
+	args := struct {
+		Start int `gjson:"start"`
+		End   int `gjson:"end"`
+	}{End: math.MaxInt32}
+	if err := ParseArgs(arg, &args); err != nil {
+		return "", err
+	}
+	if !Parse(json).IsArray() {
+		return json, nil
+	}
+	return sliceArray(ctx, json, args.Start, args.End)
+}
+
+// @first returns the first N elements of an array, or the first element when
+// no arg is provided.
+//
+//	@first:2: [1,2,3,4,5] -> [1,2]
+//
+// The original json is returned when the json is not an array.
+func modFirst(ctx ModContext, json, arg string) (string, error) {
+	n, err := countArg(arg, 1)
+	if err != nil {
+		return "", err
+	}
+	if !Parse(json).IsArray() {
+		return json, nil
+	}
+	return sliceArray(ctx, json, 0, n)
+}
+
+// @last returns the last N elements of an array, or the last element when no
+// arg is provided.
+//
+//	@last:2: [1,2,3,4,5] -> [4,5]
+//
+// The original json is returned when the json is not an array.
+func modLast(ctx ModContext, json, arg string) (string, error) {
+	n, err := countArg(arg, 1)
+	if err != nil {
+		return "", err
+	}
+	if !Parse(json).IsArray() {
+		return json, nil
+	}
+	if n == 0 {
+		return "[]", nil
+	}
+	return sliceArray(ctx, json, -n, math.MaxInt32)
+}
+
+// @skip returns the elements of an array after skipping the first N.
+//
+//	@skip:2: [1,2,3,4,5] -> [3,4,5]
+//
+// The original json is returned when the json is not an array.
+func modSkip(ctx ModContext, json, arg string) (string, error) {
+	n, err := countArg(arg, 0)
+	if err != nil {
+		return "", err
+	}
+	if !Parse(json).IsArray() {
+		return json, nil
+	}
+	return sliceArray(ctx, json, n, math.MaxInt32)
+}
+
+// @map applies a path to every element of an array, or to every value of an
+// object, and returns the results in an array or object of the same kind.
+//
+//	@map:"{first,age}": [{"first":"Tom","age":37}] -> [{"first":"Tom","age":37}]
+//
+// The arg may also be an object that maps the names of the output members to
+// paths, producing an object for every element.
+//
+//	@map:{"name":"first","years":"age"}: [{"first":"Tom","age":37}] ->
+//	  [{"name":"Tom","years":37}]
+//
+// Results that do not exist are omitted.
+// The original json is returned when the json is not an array or object.
+func modMap(ctx ModContext, json, arg string) (string, error) {
+	res := Parse(json)
+	if !res.IsArray() && !res.IsObject() {
+		return json, nil
+	}
+	var names []Result
+	var paths []string
+	tmpl := Parse(arg)
+	if tmpl.IsObject() && Valid(arg) {
+		tmpl.ForEach(func(key, value Result) bool {
+			names = append(names, key)
+			paths = append(paths, value.String())
+			return true
+		})
+	} else if tmpl.Type == String {
+		arg = tmpl.Str
+	}
+	obj := res.IsObject()
+	out := make([]byte, 0, len(json))
+	if obj {
+		out = append(out, '{')
+	} else {
+		out = append(out, '[')
+	}
+	var i int
+	err := ctx.forEach(res, func(key, value Result) error {
+		var raw []byte
+		if names != nil {
+			raw = append(raw, '{')
+			var j int
+			for k, path := range paths {
+				res, err := ctx.Get(value.Raw, path)
+				if err != nil {
+					return err
+				}
+				if !res.Exists() {
+					continue
+				}
+				if j > 0 {
+					raw = append(raw, ',')
+				}
+				raw = append(raw, names[k].Raw...)
+				raw = append(raw, ':')
+				raw = append(raw, res.Raw...)
+				j++
+			}
+			raw = append(raw, '}')
+		} else {
+			res, err := ctx.Get(value.Raw, arg)
+			if err != nil {
+				return err
+			}
+			if !res.Exists() {
+				return nil
+			}
+			raw = append(raw, res.Raw...)
+		}
+		if i > 0 {
+			out = append(out, ',')
+		}
+		if obj {
+			out = append(out, key.Raw...)
+			out = append(out, ':')
+		}
+		out = append(out, raw...)
+		i++
+		return ctx.size(len(out))
+	})
+	if err != nil {
+		return "", err
+	}
+	if obj {
+		out = append(out, '}')
+	} else {
+		out = append(out, ']')
+	}
+	return bytesString(out), nil
+}
+
+// parseFilterQuery parses a query expression, which is the inside of a
+// "#(...)" query, such as `age>40` or `=="Murphy"`. The returned
+// arrayPathResult can be used with queryMatches.
+func parseFilterQuery(expr string) (rp arrayPathResult, ok bool) {
+	path, op, value, _, _, vesc, ok := parseQuery("#(" + expr + ")")
+	if !ok {
+		return rp, false
+	}
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+		if vesc {
+			value = unescape(value)
+		}
+	}
+	rp.query.on = true
+	rp.query.path = path
+	rp.query.op = op
+	rp.query.value = value
+	return rp, true
+}
+
+// @filter keeps the elements of an array, or the members of an object, that
+// match a query. The arg is an object with a "key" and/or "value" query,
+// and an element must match both when both are provided.
+//
+// The "value" query uses the same syntax as the inside of a "#(...)" query
+// and is matched against each value.
+//
+//	@filter:{"value":"enabled==true"}
+//	@filter:{"value":">=10"}
+//
+// The "key" query is matched against each object key or array index. A key
+// query that does not start with a comparison operator is a wildcard pattern.
+//
+//	@filter:{"key":"beta_*"}
+//	@filter:{"key":"!%\"beta_*\""}
+//
+// The arg may also be a value query by itself, such as @filter:age>40.
+// An error is returned when a query is not valid, and the original json is
+// returned when the json is not an array or object.
+func modFilter(ctx ModContext, json, arg string) (string, error) {
+	if err := ctx.engine().checkPolicy("queries"); err != nil {
+		return "", err
+	}
+	var args struct {
+		Value string `gjson:"value"`
+		Key   string `gjson:"key"`
+	}
+	if opts := Parse(arg); opts.IsObject() {
+		if err := ParseArgs(arg, &args); err != nil {
+			return "", err
+		}
+	} else if opts.Type == String {
+		args.Value = opts.Str
+	} else {
+		args.Value = arg
+	}
+	res := Parse(json)
+	if !res.IsArray() && !res.IsObject() {
+		return json, nil
+	}
+	var keyq, valq *arrayPathResult
+	if expr := args.Key; expr != "" {
+		var rp arrayPathResult
+		if strings.IndexByte("=!<>%", expr[0]) != -1 {
+			var ok bool
+			if rp, ok = parseFilterQuery(expr); !ok {
+				return "", fmt.Errorf("gjson: invalid key query %q", expr)
+			}
+		} else {
+			rp.query.on = true
+			rp.query.op = "%"
+			rp.query.value = expr
+		}
+		keyq = &rp
+	}
+	if args.Value != "" {
+		rp, ok := parseFilterQuery(args.Value)
+		if !ok {
+			return "", fmt.Errorf("gjson: invalid value query %q",
+				args.Value)
+		}
+		valq = &rp
+	}
+	obj := res.IsObject()
+	out := make([]byte, 0, len(json))
+	if obj {
+		out = append(out, '{')
+	} else {
+		out = append(out, '[')
+	}
+	var i int
+	err := ctx.forEach(res, func(key, value Result) error {
+		if keyq != nil && !queryMatches(keyq, key) {
+			return nil
+		}
+		if valq != nil {
+			qval := value
+			if valq.query.path != "" {
+				if value.Type != JSON {
+					return nil
+				}
+				var err error
+				qval, err = ctx.Get(value.Raw, valq.query.path)
+				if err != nil {
+					return err
+				}
+			}
+			if !queryMatches(valq, qval) {
+				return nil
+			}
+		}
+		if i > 0 {
+			out = append(out, ',')
+		}
+		if obj {
+			out = append(out, key.Raw...)
+			out = append(out, ':')
+		}
+		out = append(out, value.Raw...)
+		i++
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if obj {
+		out = append(out, '}')
+	} else {
+		out = append(out, ']')
+	}
+	return bytesString(out), nil
+}
+
+// keysArgs are the args of the @pick and @omit modifiers. The arg is either
+// the keys by themselves, or an object with "keys" and "deep" options.
+type keysArgs struct {
+	Keys []string `gjson:"keys,required"`
+	Deep bool     `gjson:"deep"`
+}
+
+// appendMembers appends the json after passing every object key to fn, which
+// returns the raw key to use, or false to remove the member. The elements of
+// an array are processed individually. When deep is set, the values of the
+// members are processed too. All other values are copied as-is.
+func appendMembers(ctx ModContext, dst []byte, res Result, deep bool,
+	fn func(key Result) (string, bool),
+) ([]byte, error) {
+	obj := res.IsObject()
+	if !obj && !res.IsArray() {
+		return append(dst, res.Raw...), nil
+	}
+	if err := ctx.enter(); err != nil {
+		return nil, err
+	}
+	defer ctx.leave()
+	if obj {
+		dst = append(dst, '{')
+	} else {
+		dst = append(dst, '[')
+	}
+	var i int
+	err := ctx.forEach(res, func(key, value Result) error {
+		if obj {
+			kraw, ok := fn(key)
+			if !ok {
+				return nil
+			}
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = append(dst, kraw...)
+			dst = append(dst, ':')
+		} else if i > 0 {
+			dst = append(dst, ',')
+		}
+		i++
+		if obj && !deep {
+			dst = append(dst, value.Raw...)
+			return ctx.size(len(dst))
+		}
+		var err error
+		dst, err = appendMembers(ctx, dst, value, deep, fn)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if obj {
+		return append(dst, '}'), nil
+	}
+	return append(dst, ']'), nil
+}
+
+// keyMatches returns true if the key matches one of the wildcard patterns.
+func keyMatches(key Result, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matchLimit(key.Str, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// @pick keeps only the object members with the provided keys. Keys may
+// contain wildcard characters.
+//
+//	@pick:["id","name"]: {"id":1,"name":"Tom","age":37} -> {"id":1,"name":"Tom"}
+//
+// The {"keys":[...],"deep":true} arg also picks the members of nested
+// objects. The elements of an array are picked individually.
+func modPick(ctx ModContext, json, arg string) (string, error) {
+	var args keysArgs
+	if err := ParseArgs(arg, &args); err != nil {
+		return "", err
+	}
+	out, err := appendMembers(ctx, nil, Parse(json), args.Deep,
+		func(key Result) (string, bool) {
+			return key.Raw, keyMatches(key, args.Keys)
+		},
+	)
+	return bytesString(out), err
+}
+
+// @omit removes the object members with the provided keys. Keys may contain
+// wildcard characters.
+//
+//	@omit:["password","token"]: {"id":1,"password":"x"} -> {"id":1}
+//
+// The {"keys":[...],"deep":true} arg also removes the members of nested
+// objects. The elements of an array are processed individually.
+func modOmit(ctx ModContext, json, arg string) (string, error) {
+	var args keysArgs
+	if err := ParseArgs(arg, &args); err != nil {
+		return "", err
+	}
+	out, err := appendMembers(ctx, nil, Parse(json), args.Deep,
+		func(key Result) (string, bool) {
+			return key.Raw, !keyMatches(key, args.Keys)
+		},
+	)
+	return bytesString(out), err
+}
+
+// @rename renames object members.
+//
+//	@rename:{"first":"name"}: {"first":"Tom","age":37} -> {"name":"Tom","age":37}
+//
+// The {"keys":{...},"deep":true} arg also renames the members of nested
+// objects. The elements of an array are renamed individually.
+func modRename(ctx ModContext, json, arg string) (string, error) {
+	var args struct {
+		Keys Result `gjson:"keys,required"`
+		Deep bool   `gjson:"deep"`
+	}
+	if res := Parse(arg); res.IsObject() && !res.Get("keys").IsObject() {
+		// the keys by themselves
+		args.Keys = res
+	} else if err := ParseArgs(arg, &args); err != nil {
+		return "", err
+	}
+	if !args.Keys.IsObject() {
+		return "", errors.New(`gjson: arg "keys" must be an object`)
+	}
+	names := make(map[string]string)
+	var ok = true
+	args.Keys.ForEach(func(key, value Result) bool {
+		names[key.Str] = value.Str
+		ok = value.Type == String
+		return ok
+	})
+	if !ok {
+		return "", errors.New(`gjson: arg "keys" must have string values`)
+	}
+	out, err := appendMembers(ctx, nil, Parse(json), args.Deep,
+		func(key Result) (string, bool) {
+			if name, ok := names[key.Str]; ok {
+				return string(AppendJSONString(nil, name)), true
+			}
+			return key.Raw, true
+		},
+	)
+	return bytesString(out), err
+}
+
+// entriesArg parses the {"key":"k","value":"v"} arg of the @entries and
+// @fromentries modifiers, which are the field names used for each entry.
+func entriesArg(arg string) (kname, vname string, err error) {
+	args := struct {
+		Key   string `gjson:"key"`
+		Value string `gjson:"value"`
+	}{Key: "key", Value: "value"}
+	err = ParseArgs(arg, &args)
+	return args.Key, args.Value, err
+}
+
+// @entries converts an object into an array of key/value entries.
+//
+//	{"a":1,"b":2} -> [{"key":"a","value":1},{"key":"b","value":2}]
+//
+// The {"key":"k","value":"v"} arg changes the field names of the entries.
+// The original json is returned when the json is not an object.
+func modEntries(ctx ModContext, json, arg string) (string, error) {
+	kname, vname, err := entriesArg(arg)
+	if err != nil {
+		return "", err
+	}
+	res := Parse(json)
+	if !res.IsObject() {
+		return json, nil
+	}
+	kraw := AppendJSONString(nil, kname)
+	vraw := AppendJSONString(nil, vname)
+	out := make([]byte, 0, len(json)*2)
+	out = append(out, '[')
+	var i int
+	err = ctx.forEach(res, func(key, value Result) error {
+		if i > 0 {
+			out = append(out, ',')
+		}
+		out = append(out, '{')
+		out = append(out, kraw...)
+		out = append(out, ':')
+		out = append(out, key.Raw...)
+		out = append(out, ',')
+		out = append(out, vraw...)
+		out = append(out, ':')
+		out = append(out, value.Raw...)
+		out = append(out, '}')
+		i++
+		return ctx.size(len(out))
+	})
+	if err != nil {
+		return "", err
+	}
+	out = append(out, ']')
+	return bytesString(out), nil
+}
+
+// @fromentries converts an array of key/value entries into an object. This
+// is the inverse of @entries.
+//
+//	[{"key":"a","value":1},{"key":"b","value":2}] -> {"a":1,"b":2}
+//
+// The {"key":"k","value":"v"} arg changes the field names of the entries.
+// Entries without a key are ignored and entries without a value become null.
+// The original json is returned when the json is not an array.
+func modFromEntries(ctx ModContext, json, arg string) (string, error) {
+	kname, vname, err := entriesArg(arg)
+	if err != nil {
+		return "", err
+	}
+	res := Parse(json)
+	if !res.IsArray() {
+		return json, nil
+	}
+	kpath, vpath := Escape(kname), Escape(vname)
+	out := make([]byte, 0, len(json))
+	out = append(out, '{')
+	var i int
+	err = ctx.forEach(res, func(_, entry Result) error {
+		if !entry.IsObject() {
+			return nil
+		}
+		key := entry.Get(kpath)
+		if !key.Exists() {
+			return nil
+		}
+		if i > 0 {
+			out = append(out, ',')
+		}
+		if key.Type == String {
+			out = append(out, key.Raw...)
+		} else {
+			out = AppendJSONString(out, key.String())
+		}
+		out = append(out, ':')
+		if value := entry.Get(vpath); value.Exists() {
+			out = append(out, value.Raw...)
+		} else {
+			out = append(out, "null"...)
+		}
+		i++
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	out = append(out, '}')
+	return bytesString(out), nil
+}
+
+// sepArg parses the {"sep":"/"} arg of the @flattenobj and @unflatten
+// modifiers. The default separator is a dot.
+func sepArg(arg string) (string, error) {
+	args := struct {
+		Sep string `gjson:"sep"`
+	}{Sep: "."}
+	if err := ParseArgs(arg, &args); err != nil {
+		return "", err
+	}
+	if args.Sep == "" {
+		return "", errors.New(`gjson: arg "sep" must not be empty`)
+	}
+	return args.Sep, nil
+}
+
+// appendFlatObj appends the members of a flattened value to dst. The nested
+// flag is set for the values of a parent, whose keys are joined to the prefix
+// with the separator, even when the prefix is empty.
+func appendFlatObj(ctx ModContext, dst []byte, prefix []byte, value Result,
+	sep string, nested bool, n *int,
+) ([]byte, error) {
+	if (value.IsObject() || value.IsArray()) && len(trim(unwrap(value.Raw))) > 0 {
+		if err := ctx.enter(); err != nil {
+			return nil, err
+		}
+		defer ctx.leave()
+		plen := len(prefix)
+		err := ctx.forEach(value, func(key, value Result) error {
+			prefix = prefix[:plen]
+			if nested {
+				prefix = append(prefix, sep...)
+			}
+			comp := key.String()
+			if sep == "." {
+				comp = Escape(comp)
+			}
+			prefix = append(prefix, comp...)
+			var err error
+			dst, err = appendFlatObj(ctx, dst, prefix, value, sep, true, n)
+			return err
+		})
+		return dst, err
+	}
+	if *n > 0 {
+		dst = append(dst, ',')
+	}
+	dst = AppendJSONString(dst, string(prefix))
+	dst = append(dst, ':')
+	dst = append(dst, value.Raw...)
+	*n++
+	return dst, ctx.size(len(dst))
+}
+
+// @flattenobj flattens nested objects and arrays into a single object whose
+// keys are the paths to each value.
+//
+//	{"a":{"b":[1,2]},"c.d":3} -> {"a.b.0":1,"a.b.1":2,"c\\.d":3}
+//
+// Keys are escaped using Escape, so that each key is a valid path. The
+// {"sep":"/"} arg changes the separator, in which case keys are not escaped.
+// Nested empty objects and arrays are kept as values, and an empty root
+// becomes an empty object.
+// The original json is returned when the json is not an object or array.
+func modFlattenObj(ctx ModContext, json, arg string) (string, error) {
+	sep, err := sepArg(arg)
+	if err != nil {
+		return "", err
+	}
+	res := Parse(json)
+	if !res.IsObject() && !res.IsArray() {
+		return json, nil
+	}
+	if len(trim(unwrap(res.Raw))) == 0 {
+		return "{}", nil
+	}
+	var n int
+	out := make([]byte, 0, len(json))
+	out = append(out, '{')
+	out, err = appendFlatObj(ctx, out, nil, res, sep, false, &n)
+	if err != nil {
+		return "", err
+	}
+	out = append(out, '}')
+	return bytesString(out), nil
+}
+
+// flatNode is a node in the tree that is built by @unflatten.
+type flatNode struct {
+	keys []string
+	kids map[string]*flatNode
+	raw  string
+}
+
+// splitFlatKey splits a flattened key into its path components.
+func splitFlatKey(key, sep string) []string {
+	if sep != "." {
+		return strings.Split(key, sep)
+	}
+	var comps []string
+	var comp []byte
+	for i := 0; i < len(key); i++ {
+		switch key[i] {
+		case '\\':
+			if i+1 < len(key) {
+				i++
+				comp = append(comp, key[i])
+			}
+		case '.':
+			comps = append(comps, string(comp))
+			comp = comp[:0]
+		default:
+			comp = append(comp, key[i])
+		}
+	}
+	return append(comps, string(comp))
+}
+
+// appendFlatNode appends the json for a node. Nodes that only have the keys
+// 0 through N-1 become arrays.
+func appendFlatNode(ctx ModContext, dst []byte, node *flatNode) ([]byte,
+	error,
+) {
+	if node.kids == nil {
+		dst = append(dst, node.raw...)
+		return dst, ctx.size(len(dst))
+	}
+	if err := ctx.enter(); err != nil {
+		return nil, err
+	}
+	defer ctx.leave()
+	arr := true
+	for _, key := range node.keys {
+		n, ok := parseUint(key)
+		if !ok || n >= uint64(len(node.keys)) || strconv.Itoa(int(n)) != key {
+			arr = false
+			break
+		}
+	}
+	lbrace, rbrace := byte('{'), byte('}')
+	if arr {
+		lbrace, rbrace = '[', ']'
+	}
+	dst = append(dst, lbrace)
+	for i, key := range node.keys {
+		if err := ctx.step(); err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		if arr {
+			key = strconv.Itoa(i)
+		} else {
+			dst = AppendJSONString(dst, key)
+			dst = append(dst, ':')
+		}
+		var err error
+		if dst, err = appendFlatNode(ctx, dst, node.kids[key]); err != nil {
+			return nil, err
+		}
+	}
+	return append(dst, rbrace), nil
+}
+
+// @unflatten rebuilds the nested json from an object that was flattened with
+// @flattenobj. It accepts the same {"sep":"/"} arg.
+//
+//	{"a.b.0":1,"a.b.1":2,"c\\.d":3} -> {"a":{"b":[1,2]},"c.d":3}
+//
+// Objects that only have the keys 0 through N-1 become arrays. When a key
+// is repeated the last value wins.
+// The original json is returned when the json is not an object.
+func modUnflatten(ctx ModContext, json, arg string) (string, error) {
+	sep, err := sepArg(arg)
+	if err != nil {
+		return "", err
+	}
+	res := Parse(json)
+	if !res.IsObject() {
+		return json, nil
+	}
+	root := &flatNode{kids: map[string]*flatNode{}}
+	err = ctx.forEach(res, func(key, value Result) error {
+		node := root
+		for _, comp := range splitFlatKey(key.String(), sep) {
+			if node.kids == nil {
+				node.kids = map[string]*flatNode{}
+			}
+			kid, ok := node.kids[comp]
+			if !ok {
+				kid = &flatNode{}
+				node.kids[comp] = kid
+				node.keys = append(node.keys, comp)
+			}
+			node = kid
+		}
+		node.kids = nil
+		node.keys = nil
+		node.raw = value.Raw
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(root.keys) == 0 {
+		return "{}", nil
+	}
+	out, err := appendFlatNode(ctx, nil, root)
+	return bytesString(out), err
+}
+
+// strArg returns the string of an arg, which may be a json string or just
+// characters.
+func strArg(arg string) string {
+	if len(arg) > 0 && arg[0] == '"' {
+		if res := Parse(arg); res.Type == String {
+			return res.Str
+		}
+	}
+	return arg
+}
+
+// mapStrings passes a string, or every string in an array, to fn and
+// returns the raw json results. Values that are not strings are kept as-is.
+// The original json is returned when the json is not a string or array.
+func mapStrings(ctx ModContext, json string,
+	fn func(dst []byte, s string) []byte,
+) (string, error) {
+	res := Parse(json)
+	if res.Type == String {
+		return bytesString(fn(nil, res.Str)), nil
+	}
+	if !res.IsArray() {
+		return json, nil
+	}
+	out := make([]byte, 0, len(json))
+	out = append(out, '[')
+	var i int
+	err := ctx.forEach(res, func(_, value Result) error {
+		if i > 0 {
+			out = append(out, ',')
+		}
+		if value.Type == String {
+			out = fn(out, value.Str)
+		} else {
+			out = append(out, value.Raw...)
+		}
+		i++
+		return ctx.size(len(out))
+	})
+	if err != nil {
+		return "", err
+	}
+	out = append(out, ']')
+	return bytesString(out), nil
+}
+
+// @lower converts a string, or every string in an array, to lowercase.
+//
+//	"Tom" -> "tom"
+func modLower(ctx ModContext, json, arg string) (string, error) {
+	if err := noArgs(arg); err != nil {
+		return "", err
+	}
+	return mapStrings(ctx, json, func(dst []byte, s string) []byte {
+		return AppendJSONString(dst, strings.ToLower(s))
+	})
+}
+
+// @upper converts a string, or every string in an array, to uppercase.
+//
+//	"Tom" -> "TOM"
+func modUpper(ctx ModContext, json, arg string) (string, error) {
+	if err := noArgs(arg); err != nil {
+		return "", err
+	}
+	return mapStrings(ctx, json, func(dst []byte, s string) []byte {
+		return AppendJSONString(dst, strings.ToUpper(s))
+	})
+}
+
+// @trim removes the leading and trailing whitespace from a string, or every
+// string in an array. The arg may provide the characters to remove instead.
+//
+//	"  Tom  " -> "Tom"
+//	@trim:"_-": "__Tom-" -> "Tom"
+func modTrim(ctx ModContext, json, arg string) (string, error) {
+	cutset := strArg(arg)
+	return mapStrings(ctx, json, func(dst []byte, s string) []byte {
+		if cutset == "" {
+			s = strings.TrimSpace(s)
+		} else {
+			s = strings.Trim(s, cutset)
+		}
+		return AppendJSONString(dst, s)
+	})
+}
+
+// @split splits a string, or every string in an array, into an array of
+// strings using the arg as the separator. An empty separator splits the
+// string into its characters.
+//
+//	@split:",": "a,b,c" -> ["a","b","c"]
+func modSplit(ctx ModContext, json, arg string) (string, error) {
+	sep := strArg(arg)
+	return mapStrings(ctx, json, func(dst []byte, s string) []byte {
+		dst = append(dst, '[')
+		for i, part := range strings.Split(s, sep) {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = AppendJSONString(dst, part)
+		}
+		return append(dst, ']')
+	})
+}
+
+// @replace replaces the "old" text with the "new" text in a string, or
+// every string in an array. The optional "n" limits the number of
+// replacements.
+//
+//	@replace:{"old":"-","new":"_"}: "a-b-c" -> "a_b_c"
+func modReplace(ctx ModContext, json, arg string) (string, error) {
+	args := struct {
+		Old string `gjson:"old,required"`
+		New string `gjson:"new"`
+		N   int    `gjson:"n"`
+	}{N: -1}
+	if err := ParseArgs(arg, &args); err != nil {
+		return "", err
+	}
+	return mapStrings(ctx, json, func(dst []byte, s string) []byte {
+		return AppendJSONString(dst,
+			strings.Replace(s, args.Old, args.New, args.N))
+	})
+}
+
+// @substr returns part of a string, or of every string in an array. The
+// "start" and "len" are counted in characters, not bytes, and a negative
+// start is relative to the end of the string. Without a "len" the rest of
+// the string is returned.
+//
+//	@substr:{"start":0,"len":3}: "Thomas" -> "Tho"
+//	@substr:{"start":-2}: "Thomas" -> "as"
+func modSubstr(ctx ModContext, json, arg string) (string, error) {
+	args := struct {
+		Start int `gjson:"start"`
+		Len   int `gjson:"len"`
+	}{Len: -1}
+	if err := ParseArgs(arg, &args); err != nil {
+		return "", err
+	}
+	start, length := args.Start, args.Len
+	return mapStrings(ctx, json, func(dst []byte, s string) []byte {
+		n := utf8.RuneCountInString(s)
+		i := start
+		if i < 0 {
+			i = max(0, i+n)
+		}
+		i = min(i, n)
+		j := n
+		if length >= 0 {
+			j = min(n, i+length)
+		}
+		// convert the rune positions to byte positions
+		var k, bi, bj int
+		bi, bj = len(s), len(s)
+		for pos := range s {
+			if k == i {
+				bi = pos
+			}
+			if k == j {
+				bj = pos
+				break
+			}
+			k++
+		}
+		return AppendJSONString(dst, s[bi:bj])
+	})
+}
+
+// @concat joins the values of an array into a single string. The arg may
+// provide a separator.
+//
+//	["a","b",1] -> "ab1"
+//	@concat:", ": ["a","b"] -> "a, b"
+//
+// The original json is returned when the json is not an array.
+func modConcat(ctx ModContext, json, arg string) (string, error) {
+	res := Parse(json)
+	if !res.IsArray() {
+		return json, nil
+	}
+	sep := strArg(arg)
+	var s []byte
+	var i int
+	err := ctx.forEach(res, func(_, value Result) error {
+		if i > 0 {
+			s = append(s, sep...)
+		}
+		s = append(s, value.String()...)
+		i++
+		return ctx.size(len(s))
+	})
+	if err != nil {
+		return "", err
+	}
+	return bytesString(AppendJSONString(nil, bytesString(s))), nil
+}
+
+// encodingInput returns the bytes that the encoding modifiers operate on,
+// which is the text of a string, or the raw json of any other value.
+func encodingInput(res Result) string {
+	if res.Type == String {
+		return res.Str
+	}
+	return res.Raw
+}
+
+// base64Encodings returns the encoding that is named by the "encoding" arg,
+// which is one of "std", "url", "rawstd", or "rawurl". All of the encodings
+// are returned, starting with "std", when the arg is not provided.
+func base64Encodings(arg string) ([]*base64.Encoding, error) {
+	var args struct {
+		Encoding string `gjson:"encoding"`
+	}
+	if err := ParseArgs(arg, &args); err != nil {
+		return nil, err
+	}
+	switch args.Encoding {
+	case "":
+		return []*base64.Encoding{base64.StdEncoding, base64.URLEncoding,
+			base64.RawStdEncoding, base64.RawURLEncoding}, nil
+	case "std":
+		return []*base64.Encoding{base64.StdEncoding}, nil
+	case "url":
+		return []*base64.Encoding{base64.URLEncoding}, nil
+	case "rawstd":
+		return []*base64.Encoding{base64.RawStdEncoding}, nil
+	case "rawurl":
+		return []*base64.Encoding{base64.RawURLEncoding}, nil
+	}
+	return nil, errors.New(`gjson: arg "encoding" must be "std", "url", ` +
+		`"rawstd", or "rawurl"`)
+}
+
+// @base64 encodes a string, or the json of any other value, as a base64
+// string. The arg may be "url", "rawstd", or "rawurl" for other alphabets.
+//
+//	"hello" -> "aGVsbG8="
+func modBase64(ctx ModContext, json, arg string) (string, error) {
+	encs, err := base64Encodings(arg)
+	if err != nil {
+		return "", err
+	}
+	res := Parse(json)
+	if !res.Exists() {
+		return json, nil
+	}
+	return bytesString(AppendJSONString(nil,
+		encs[0].EncodeToString(stringBytes(encodingInput(res))))), nil
+}
+
+// @unbase64 decodes a base64 string. The arg may be "std", "url", "rawstd",
+// or "rawurl". Without an arg all of the alphabets are attempted.
+// Nothing is returned when the string cannot be decoded.
+//
+//	"aGVsbG8=" -> "hello"
+//
+// Use @unbase64|@fromstr to get embedded json.
+func modUnbase64(ctx ModContext, json, arg string) (string, error) {
+	encs, err := base64Encodings(arg)
+	if err != nil {
+		return "", err
+	}
+	res := Parse(json)
+	if res.Type != String {
+		return "", nil
+	}
+	for _, enc := range encs {
+		if data, err := enc.DecodeString(res.Str); err == nil {
+			return bytesString(AppendJSONString(nil, bytesString(data))), nil
+		}
+	}
+	return "", nil
+}
+
+// @hex encodes a string, or the json of any other value, as a hex string.
+//
+//	"hi" -> "6869"
+func modHex(ctx ModContext, json, arg string) (string, error) {
+	if err := noArgs(arg); err != nil {
+		return "", err
+	}
+	res := Parse(json)
+	if !res.Exists() {
+		return json, nil
+	}
+	return bytesString(AppendJSONString(nil,
+		hex.EncodeToString(stringBytes(encodingInput(res))))), nil
+}
+
+// @urlencode escapes a string, or the json of any other value, so that it
+// can be used in a url query.
+//
+//	"a b&c" -> "a+b%26c"
+func modURLEncode(ctx ModContext, json, arg string) (string, error) {
+	if err := noArgs(arg); err != nil {
+		return "", err
+	}
+	res := Parse(json)
+	if !res.Exists() {
+		return json, nil
+	}
+	return bytesString(AppendJSONString(nil,
+		url.QueryEscape(encodingInput(res)))), nil
+}
+
+// @urldecode unescapes a url query string. Nothing is returned when the
+// string cannot be decoded.
+//
+//	"a+b%26c" -> "a b&c"
+func modURLDecode(ctx ModContext, json, arg string) (string, error) {
+	if err := noArgs(arg); err != nil {
+		return "", err
+	}
+	res := Parse(json)
+	if res.Type != String {
+		return "", nil
+	}
+	s, err := url.QueryUnescape(res.Str)
+	if err != nil {
+		return "", nil
+	}
+	return bytesString(AppendJSONString(nil, s)), nil
+}
+
+// hashInput returns the bytes that the hashing modifiers operate on, which
+// is the canonical form of the value. This makes values that are
+// semantically equal have the same hash, and strings keep their quotes, so
+// "1" and 1 have different hashes.
+func hashInput(res Result) []byte {
+	return appendCanonical(nil, res)
+}
+
+// @sha256 returns the hex encoded SHA-256 hash of a value.
+//
+//	{"b":2,"a":1} -> "43258cff783fe7036d8a43033f830adfc60ec037382473548ac742b888292777"
+func modSHA256(ctx ModContext, json, arg string) (string, error) {
+	if err := noArgs(arg); err != nil {
+		return "", err
+	}
+	res := Parse(json)
+	if !res.Exists() {
+		return json, nil
+	}
+	if err := ctx.walk(res); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(hashInput(res))
+	return `"` + hex.EncodeToString(sum[:]) + `"`, nil
+}
+
+// @md5 returns the hex encoded MD5 hash of a value.
+func modMD5(ctx ModContext, json, arg string) (string, error) {
+	if err := noArgs(arg); err != nil {
+		return "", err
+	}
+	res := Parse(json)
+	if !res.Exists() {
+		return json, nil
+	}
+	if err := ctx.walk(res); err != nil {
+		return "", err
+	}
+	sum := md5.Sum(hashInput(res))
+	return `"` + hex.EncodeToString(sum[:]) + `"`, nil
+}
+
+// @crc32 returns the hex encoded CRC-32 (IEEE) checksum of a value.
+func modCRC32(ctx ModContext, json, arg string) (string, error) {
+	if err := noArgs(arg); err != nil {
+		return "", err
+	}
+	res := Parse(json)
+	if !res.Exists() {
+		return json, nil
+	}
+	if err := ctx.walk(res); err != nil {
+		return "", err
+	}
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(hashInput(res)))
+	return `"` + hex.EncodeToString(sum[:]) + `"`, nil
+}
+
+// @type returns the type of a value, which is one of "null", "boolean",
+// "number", "string", "array", or "object".
+//
+//	{"a":1} -> "object"
+//
+// Nothing is returned when the value does not exist.
+func modType(ctx ModContext, json, arg string) (string, error) {
+	if err := noArgs(arg); err != nil {
+		return "", err
+	}
+	res := Parse(json)
+	switch {
+	case !res.Exists():
+		return "", nil
+	case res.IsObject():
+		return `"object"`, nil
+	case res.IsArray():
+		return `"array"`, nil
+	case res.IsBool():
+		return `"boolean"`, nil
+	}
+	return `"` + strings.ToLower(res.Type.String()) + `"`, nil
+}
+
+// @len returns the number of characters in a string, the number of elements
+// in an array, or the number of members in an object.
+//
+//	"héllo" -> 5
+//	[1,2,3] -> 3
+//
+// Nothing is returned for other values.
+func modLen(ctx ModContext, json, arg string) (string, error) {
+	if err := noArgs(arg); err != nil {
+		return "", err
+	}
+	res := Parse(json)
+	switch {
+	case res.Type == String:
+		return strconv.Itoa(utf8.RuneCountInString(res.Str)), nil
+	case res.IsArray(), res.IsObject():
+		var n int
+		err := ctx.forEach(res, func(_, _ Result) error {
+			n++
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(n), nil
+	}
+	return "", nil
+}
+
+// @exists returns true when the value exists.
+//
+//	{hasEmail:email.@exists}
+func modExists(ctx ModContext, json, arg string) (string, error) {
+	if err := noArgs(arg); err != nil {
+		return "", err
+	}
+	if Parse(json).Exists() {
+		return "true", nil
+	}
+	return "false", nil
+}
+
+// @isnull returns true when the value is null.
+func modIsNull(ctx ModContext, json, arg string) (string, error) {
+	if err := noArgs(arg); err != nil {
+		return "", err
+	}
+	res := Parse(json)
+	if res.Exists() && res.Type == Null {
+		return "true", nil
+	}
+	return "false", nil
+}
+
+// @default returns the arg when the value does not exist or is null,
+// otherwise the value is returned. The arg should be json, and any other
+// characters are used as a string.
+//
+//	{name:name.@default:"n/a",age:age.@default:0}
+func modDefault(ctx ModContext, json, arg string) (string, error) {
+	res := Parse(json)
+	if res.Exists() && res.Type != Null {
+		return json, nil
+	}
+	if Valid(arg) {
+		return arg, nil
+	}
+	return bytesString(AppendJSONString(nil, arg)), nil
+}
+
+// @coalesce returns the value of the first path that exists.
+//
+//	@coalesce:["email","contact.email"]
+//
+// Nothing is returned when none of the paths exist.
+func modCoalesce(ctx ModContext, json, arg string) (string, error) {
+	var args struct {
+		Paths []string `gjson:"paths,required"`
+	}
+	if err := ParseArgs(arg, &args); err != nil {
+		return "", err
+	}
+	for _, path := range args.Paths {
+		res, err := ctx.Get(json, path)
+		if err != nil {
+			return "", err
+		}
+		if res.Exists() {
+			return res.Raw, nil
+		}
+	}
+	return "", nil
+}
+
+// @groupby groups the elements of an array by the value at the "key" path,
+// and produces one object for each distinct key, in the order that the keys
+// first appear. The "agg" option maps the names of output members to a
+// modifier, with an optional arg, that is applied to the elements of each
+// group.
+//
+//	@groupby:{"key":"dept","agg":{"total":"sum:salary","n":"count"}}
+//
+//	[{"dept":"a","salary":10},{"dept":"b","salary":5},{"dept":"a","salary":2}]
+//	  -> [{"dept":"a","total":12,"n":2},{"dept":"b","total":5,"n":1}]
+//
+// Without "agg", each group has an "items" member with its elements, and
+// without "key", the elements themselves are the keys. Keys are compared
+// semantically, like @unique. The elements where the key does not exist are
+// in a group of their own, which has no key member, and that is not the same
+// as the group of a null key. It's an error for "agg" to name a modifier that
+// does not exist.
+// The original json is returned when the json is not an array.
+func modGroupBy(ctx ModContext, json, arg string) (string, error) {
+	var args struct {
+		Key string `gjson:"key"`
+		Agg Result `gjson:"agg"`
+	}
+	if err := ParseArgs(arg, &args); err != nil {
+		return "", err
+	}
+	if args.Agg.Exists() && !args.Agg.IsObject() {
+		return "", errors.New(`gjson: arg "agg" must be an object`)
+	}
+	keyPath := args.Key
+	var aggNames []Result
+	var aggs []string
+	ok := true
+	args.Agg.ForEach(func(key, value Result) bool {
+		aggNames = append(aggNames, key)
+		aggs = append(aggs, value.Str)
+		ok = value.Type == String
+		return ok
+	})
+	if !ok {
+		return "", errors.New(`gjson: arg "agg" must have string values`)
+	}
+	for _, agg := range aggs {
+		name, _, _ := strings.Cut(agg, ":")
+		if _, ok := ctx.engine().modifier(name); !ok {
+			return "", fmt.Errorf(`gjson: arg "agg" has unknown modifier %q`,
+				name)
+		}
+	}
+	res := Parse(json)
+	if !res.IsArray() {
+		return json, nil
+	}
+	var keyName []byte
+	if last := nameOfLast(keyPath); isSimpleName(last) && last != "" {
+		keyName = AppendJSONString(nil, last)
+	} else {
+		keyName = []byte(`"key"`)
+	}
+	var keys [][]byte
+	var items [][]Result
+	idxs := make(map[string]int)
+	var ckey []byte
+	err := ctx.forEach(res, func(_, value Result) error {
+		key := value
+		if keyPath != "" {
+			var err error
+			if key, err = ctx.Get(value.Raw, keyPath); err != nil {
+				return err
+			}
+		}
+		if err := ctx.walk(key); err != nil {
+			return err
+		}
+		// the key of a missing value is empty, which is not null
+		ckey = ckey[:0]
+		if key.Exists() {
+			ckey = appendCanonical(ckey, key)
+		}
+		idx, ok := idxs[string(ckey)]
+		if !ok {
+			idx = len(keys)
+			idxs[string(ckey)] = idx
+			keys = append(keys, []byte(key.Raw))
+			items = append(items, nil)
+		}
+		items[idx] = append(items[idx], value)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	groups := make([][]byte, len(keys))
+	for i := range keys {
+		var group []byte
+		if len(keys[i]) > 0 {
+			group = append(group, ',')
+			group = append(group, keyName...)
+			group = append(group, ':')
+			group = append(group, keys[i]...)
+		}
+		elems := bytesString(appendRawArray(nil, items[i]))
+		if aggs == nil {
+			group = append(group, `,"items":`...)
+			group = append(group, elems...)
+		}
+		for j, agg := range aggs {
+			name, aggArg, _ := strings.Cut(agg, ":")
+			out, _, err := ctx.callModifier(name, elems, aggArg)
+			if err != nil {
+				return "", err
+			}
+			if !Parse(out).Exists() {
+				continue
+			}
+			group = append(group, ',')
+			group = append(group, aggNames[j].Raw...)
+			group = append(group, ':')
+			group = append(group, out...)
+		}
+		groups[i] = group
+		if err := ctx.size(len(group)); err != nil {
+			return "", err
+		}
+	}
+	return bytesString(appendGroups(nil, groups)), nil
+}
+
+// @zip combines an array of arrays into an array of tuples, where the Nth
+// tuple has the Nth element of each array. The result is as long as the
+// shortest array.
+//
+//	[[1,2,3],["a","b"]] -> [[1,"a"],[2,"b"]]
+//
+// It's an error for an element to not be an array.
+// The original json is returned when the json is not an array.
+func modZip(ctx ModContext, json, arg string) (string, error) {
+	if err := noArgs(arg); err != nil {
+		return "", err
+	}
+	res := Parse(json)
+	if !res.IsArray() {
+		return json, nil
+	}
+	var cols [][]Result
+	err := ctx.forEach(res, func(_, value Result) error {
+		if !value.IsArray() {
+			return fmt.Errorf("gjson: element %d is not an array", len(cols))
+		}
+		col, err := ctx.array(value)
+		cols = append(cols, col)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	n := 0
+	for i, col := range cols {
+		if i == 0 || len(col) < n {
+			n = len(col)
+		}
+	}
+	out := make([]byte, 0, len(json))
+	out = append(out, '[')
+	tuple := make([]Result, len(cols))
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			out = append(out, ',')
+		}
+		for j, col := range cols {
+			tuple[j] = col[i]
+		}
+		out = appendRawArray(out, tuple)
+		if err := ctx.size(len(out)); err != nil {
+			return "", err
+		}
+	}
+	out = append(out, ']')
+	return bytesString(out), nil
+}
+
+// @chunk splits an array into arrays of N elements. The last array may have
+// fewer elements.
+//
+//	@chunk:2: [1,2,3,4,5] -> [[1,2],[3,4],[5]]
+//
+// The original json is returned when the json is not an array.
+func modChunk(ctx ModContext, json, arg string) (string, error) {
+	var args struct {
+		Size int `gjson:"size,required,min=1"`
+	}
+	if err := ParseArgs(arg, &args); err != nil {
+		return "", err
+	}
+	res := Parse(json)
+	if !res.IsArray() {
+		return json, nil
+	}
+	n := args.Size
+	values, err := ctx.array(res)
+	if err != nil {
+		return "", err
+	}
+	out := make([]byte, 0, len(json)+len(values)/n*2+2)
+	out = append(out, '[')
+	for i := 0; i < len(values); i += n {
+		if i > 0 {
+			out = append(out, ',')
+		}
+		out = appendRawArray(out, values[i:min(i+n, len(values))])
+		if err := ctx.size(len(out)); err != nil {
+			return "", err
+		}
+	}
+	out = append(out, ']')
+	return bytesString(out), nil
+}
+
+// @window returns the sliding windows of an array. The "size" is the number
+// of elements in each window and the "step" is the distance between the
+// start of each window, which is 1 by default. Only full windows are
+// returned.
+//
+//	@window:{"size":3}: [1,2,3,4] -> [[1,2,3],[2,3,4]]
+//	@window:{"size":2,"step":2}: [1,2,3,4,5] -> [[1,2],[3,4]]
+//
+// The original json is returned when the json is not an array.
+func modWindow(ctx ModContext, json, arg string) (string, error) {
+	args := struct {
+		Size int `gjson:"size,required,min=1"`
+		Step int `gjson:"step,min=1"`
+	}{Step: 1}
+	if err := ParseArgs(arg, &args); err != nil {
+		return "", err
+	}
+	res := Parse(json)
+	if !res.IsArray() {
+		return json, nil
+	}
+	values, err := ctx.array(res)
+	if err != nil {
+		return "", err
+	}
+	// a step past the end does not need to overflow
+	size, step := args.Size, min(args.Step, len(values)+1)
+	out := make([]byte, 0, len(json))
+	out = append(out, '[')
+	for i := 0; i+size <= len(values); i += step {
+		if i > 0 {
+			out = append(out, ',')
+		}
+		out = appendRawArray(out, values[i:i+size])
+		if err := ctx.size(len(out)); err != nil {
+			return "", err
+		}
+	}
+	out = append(out, ']')
+	return bytesString(out), nil
+}
+
+// noArgs returns an error when the arg of a modifier without options is
+// not empty.
+func noArgs(arg string) error {
+	return ParseArgs(arg, &struct{}{})
+}
+
+// ParseArgs decodes the arg of a modifier into the struct that v points to.
+//
+// The arg may be a json object, such as {"width":8,"fill":"0"}, where each
+// member is stored in the field with the matching `gjson` tag, or the
+// matching field name. Or the arg may be a list of positional values, such
+// as 8,"0", which are stored in the fields in the order that they are
+// declared. Values that are not valid json are used as strings, which means
+// that @case:upper and @case:"upper" are the same.
+//
+// Fields that are not in the arg keep their current values, which allows
+// for defaults to be set prior to calling ParseArgs. The tag options
+// "required", "min=N", and "max=N" validate a field, and a struct with a
+// Validate() error method is validated after it's decoded.
+//
+//	type padArgs struct {
+//		Width int    `gjson:"width,required,min=0"`
+//		Fill  string `gjson:"fill"`
+//	}
+//	args := padArgs{Fill: " "}
+//	if err := gjson.ParseArgs(arg, &args); err != nil {
+//		return "", err
+//	}
+//
+// Supported field types are strings, bools, numbers, slices of those types,
+// Result, and interface{}.
+func ParseArgs(arg string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("gjson: ParseArgs expects a pointer to a struct")
+	}
+	rv = rv.Elem()
+	fields, err := argFields(rv.Type())
+	if err != nil {
+		return err
+	}
+	set := make([]bool, len(fields))
+	if res := Parse(arg); res.IsObject() && Valid(arg) {
+		res.ForEach(func(key, value Result) bool {
+			for i, f := range fields {
+				if strings.EqualFold(f.name, key.Str) {
+					err = setArgField(rv.Field(f.index), f.name, value)
+					set[i] = true
+					break
+				}
+			}
+			return err == nil
+		})
+	} else {
+		values := splitArgs(arg)
+		if len(values) > len(fields) {
+			return fmt.Errorf("gjson: too many args, expected at most %d",
+				len(fields))
+		}
+		for i, value := range values {
+			err = setArgField(rv.Field(fields[i].index), fields[i].name, value)
+			if err != nil {
+				break
+			}
+			set[i] = true
+		}
+	}
+	if err != nil {
+		return err
+	}
+	for i, f := range fields {
+		if f.required && !set[i] {
+			return fmt.Errorf("gjson: arg %q is required", f.name)
+		}
+		if err := f.validate(rv.Field(f.index)); err != nil {
+			return err
+		}
+	}
+	if val, ok := v.(interface{ Validate() error }); ok {
+		return val.Validate()
+	}
+	return nil
+}
+
+// argField is a struct field that is used by ParseArgs.
+type argField struct {
+	index    int
+	name     string
+	required bool
+	hasMin   bool
+	min      float64
+	hasMax   bool
+	max      float64
+}
+
+// argFields returns the fields of a struct that are used by ParseArgs.
+func argFields(t reflect.Type) ([]argField, error) {
+	var fields []argField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("gjson")
+		if !sf.IsExported() || tag == "-" {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		f := argField{index: i, name: opts[0]}
+		if f.name == "" {
+			f.name = sf.Name
+		}
+		for _, opt := range opts[1:] {
+			var err error
+			switch {
+			case opt == "required":
+				f.required = true
+			case strings.HasPrefix(opt, "min="):
+				f.hasMin = true
+				f.min, err = strconv.ParseFloat(opt[4:], 64)
+			case strings.HasPrefix(opt, "max="):
+				f.hasMax = true
+				f.max, err = strconv.ParseFloat(opt[4:], 64)
+			default:
+				err = errors.New("unknown option")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("gjson: invalid tag option %q for %s",
+					opt, sf.Name)
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// validate checks the min and max of a number field.
+func (f argField) validate(fv reflect.Value) error {
+	var n float64
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		n = float64(fv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+		n = float64(fv.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = fv.Float()
+	default:
+		return nil
+	}
+	if f.hasMin && n < f.min {
+		return fmt.Errorf("gjson: arg %q must be at least %v", f.name, f.min)
+	}
+	if f.hasMax && n > f.max {
+		return fmt.Errorf("gjson: arg %q must be at most %v", f.name, f.max)
+	}
+	return nil
+}
+
+// splitArgs splits positional args, such as 8,"0", into values. Values that
+// are not valid json are used as strings.
+func splitArgs(arg string) []Result {
+	if trim(arg) == "" {
+		return nil
+	}
+	var values []Result
+	var s, depth int
+	for i := 0; i <= len(arg); i++ {
+		if i < len(arg) {
+			switch arg[i] {
+			case '"':
+				for i++; i < len(arg) && arg[i] != '"'; i++ {
+					if arg[i] == '\\' {
+						i++
+					}
+				}
+				continue
+			case '{', '[':
+				depth++
+				continue
+			case '}', ']':
+				depth--
+				continue
+			case ',':
+				if depth > 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+		part := trim(arg[s:i])
+		if Valid(part) {
+			values = append(values, Parse(part))
+		} else {
+			values = append(values, Result{Type: String, Str: part,
+				Raw: string(AppendJSONString(nil, part))})
+		}
+		s = i + 1
+	}
+	return values
+}
+
+// setArgField stores a json value in a struct field.
+func setArgField(fv reflect.Value, name string, value Result) error {
+	typeErr := func(what string) error {
+		return fmt.Errorf("gjson: arg %q must be %s", name, what)
+	}
+	if fv.Type() == reflect.TypeOf(Result{}) {
+		fv.Set(reflect.ValueOf(value))
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		if value.Type != String {
+			return typeErr("a string")
+		}
+		fv.SetString(value.Str)
+	case reflect.Bool:
+		if !value.IsBool() {
+			return typeErr("a bool")
+		}
+		fv.SetBool(value.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		n, ok := parseInt(value.Raw)
+		if value.Type != Number || !ok || fv.OverflowInt(n) {
+			return typeErr("an integer")
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+		n, ok := parseUint(value.Raw)
+		if value.Type != Number || !ok || fv.OverflowUint(n) {
+			return typeErr("a positive integer")
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		if value.Type != Number {
+			return typeErr("a number")
+		}
+		fv.SetFloat(value.Num)
+	case reflect.Slice:
+		values := []Result{value}
+		if value.IsArray() {
+			values = value.Array()
+		}
+		slice := reflect.MakeSlice(fv.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setArgField(slice.Index(i), name, value); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+	case reflect.Interface:
+		if fv.NumMethod() > 0 {
+			return typeErr("an empty interface")
+		}
+		fv.Set(reflect.ValueOf(value.Value()))
+	default:
+		return fmt.Errorf("gjson: arg %q has an unsupported type %s", name,
+			fv.Type())
+	}
+	return nil
 }
 
 // All iterates over a json result.
@@ -2,13 +2,20 @@ package gjson
 
 import (
 	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"math"
 	"math/rand"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -2758,3 +2765,1289 @@ func TestIter(t *testing.T) {
 	}
 
 }
+
+func TestModSort(t *testing.T) {
+	json := `{"friends":[
+		{"first":"Dale","last":"Murphy","age":44},
+		{"first":"Roger","last":"craig","age":68},
+		{"first":"Jane","last":"Murphy","age":47},
+		{"first":"Alex","last":"Murphy","age":44}
+	]}`
+	assert(t, Get(`[3,1,"b",null,2,"A"]`, "@sort").Raw == `[null,1,2,3,"A","b"]`)
+	assert(t, Get(json, `friends.@sort:{"by":"age"}.#.first`).Raw ==
+		`["Dale","Alex","Jane","Roger"]`)
+	assert(t, Get(json, `friends.@sort:{"by":"age","desc":true}.#.first`).Raw ==
+		`["Roger","Jane","Dale","Alex"]`)
+	assert(t, Get(json, `friends.@sort:{"by":["last","first"]}.#.first`).Raw ==
+		`["Alex","Dale","Jane","Roger"]`)
+	assert(t, Get(json, `friends.@sort:{"by":["last","first"],"caseSensitive":false}.#.first`).Raw ==
+		`["Roger","Alex","Dale","Jane"]`)
+	assert(t, Get(json, `friends.0|@sort`).Raw == Get(json, `friends.0`).Raw)
+}
+
+func TestModAggregate(t *testing.T) {
+	json := `{"orders":[{"total":10},{"total":"5"},{"total":2.5},{},{"total":null}]}`
+	assert(t, Get(`[1,2,3]`, "@sum").Raw == `6`)
+	assert(t, Get(`[1,2,3]`, "@avg").Raw == `2`)
+	assert(t, Get(`[3,1,2]`, "@min").Raw == `1`)
+	assert(t, Get(`[3,1,2]`, "@max").Raw == `3`)
+	assert(t, Get(`[]`, "@sum").Raw == `0`)
+	assert(t, Get(`[]`, "@avg").Raw == `null`)
+	assert(t, Get(`[]`, "@max").Raw == `null`)
+	assert(t, Get(`{"a":1}`, "@sum").Exists() == false)
+	assert(t, Get(json, "orders.@sum:total").Raw == `12.5`)
+	assert(t, Get(json, `orders.@sum:{"path":"total","policy":"coerce"}`).Raw == `17.5`)
+	assert(t, Get(json, `orders.@sum:{"path":"total","policy":"fail"}`).Exists() == false)
+	assert(t, Get(json, "orders.@avg:total").Float() == 6.25)
+	assert(t, Get(json, "orders.@min:total").Raw == `2.5`)
+	assert(t, Get(json, `orders.@min:{"path":"total","policy":"coerce"}`).Raw == `0`)
+	assert(t, Get(json, "orders.@max:total").Raw == `"5"`)
+	assert(t, Get(json, `orders.@max:{"path":"total","policy":"skip"}`).Raw == `10`)
+	assert(t, Get(`["b","a"]`, "@min").Raw == `"a"`)
+	assert(t, Get(`["b","a"]`, "@max").Raw == `"b"`)
+	assert(t, Get(`[2,"a",null,true,{"a":1}]`, "@min").Raw == `2`)
+	assert(t, Get(`[2,"a",null,true,{"a":1}]`, "@max").Raw == `{"a":1}`)
+	assert(t, Get(`[null]`, "@min").Raw == `null`)
+	assert(t, Get(`[1e300,1e300]`, "@sum").Raw == `2e+300`)
+	assert(t, Get(`[1e-7,1e-7]`, "@avg").Raw == `1e-07`)
+	assert(t, Get(`[0.5,1e21]`, "@sum").Raw == `1e+21`)
+	assert(t, Get(`["1e25"]`, `@max:{"policy":"coerce"}`).Raw == `1e+25`)
+	assert(t, Get(json, "orders.@count").Raw == `5`)
+	assert(t, Get(json, "orders.@count:total").Raw == `3`)
+	assert(t, Get(json, `{"n":orders.@count,"sum":orders.@sum:total}`).Raw ==
+		`{"n":5,"sum":12.5}`)
+	// sums that overflow
+	assert(t, Get(`[1e308,1e308]`, "@sum").Raw == `null`)
+	assert(t, Get(`[-1e308,-1e308]`, "@sum").Raw == `null`)
+	assert(t, Get(`[1e308,1e308]`, "@avg").Float() == 1e308)
+	assert(t, Get(`[1e308,1e308]`, "@max").Raw == `1e308`)
+	assert(t, Get(`["NaN","-Inf",1]`, `@min:{"policy":"coerce"}`).Raw == `0`)
+	assert(t, Get(`["Inf"]`, `@sum:{"policy":"coerce"}`).Raw == `0`)
+}
+
+func TestModUnique(t *testing.T) {
+	assert(t, Get(`[1,2,1.0,"a",3,2,"a",10e-1]`, "@unique").Raw == `[1,2,"a",3]`)
+	assert(t, Get(`[{"a":1,"b":2},{"b":2,"a":1},{"a":1}]`, "@unique").Raw ==
+		`[{"a":1,"b":2},{"a":1}]`)
+	assert(t, Get(`["A","A",[1,{"x":1}],[1.0,{"x":1}]]`, "@unique").Raw ==
+		`["A",[1,{"x":1}]]`)
+	json := `{"users":[{"id":1,"n":"a"},{"id":2,"n":"b"},{"id":1.0,"n":"c"},{"n":"d"},{"n":"e"}]}`
+	assert(t, Get(json, "users.@unique:id|#.n").Raw == `["a","b","d"]`)
+	assert(t, Get(`{"a":1}`, "@unique").Raw == `{"a":1}`)
+	assert(t, Get(`[9007199254740993,9007199254740992,9007199254740993]`,
+		"@unique").Raw == `[9007199254740993,9007199254740992]`)
+	assert(t, Get(`[1,1.0,1e0,10e-1,100e-2,0.1e1]`, "@unique").Raw == `[1]`)
+	assert(t, Get(`[1e400,1e401,1e400,1.5e-400,15e-401,0,-0.0]`, "@unique").Raw ==
+		`[1e400,1e401,1.5e-400,0]`)
+	assert(t, Get(`[{"id":null},{},{"id":null},{}]`, "@unique:id").Raw ==
+		`[{"id":null},{}]`)
+}
+
+func TestModSlice(t *testing.T) {
+	json := `{"items":[1, "two" ,{"n":3},[4],5]}`
+	assert(t, Get(json, `items.@slice:{"start":1,"end":3}`).Raw == `["two",{"n":3}]`)
+	assert(t, Get(json, `items.@slice:{"start":-2}`).Raw == `[[4],5]`)
+	assert(t, Get(json, `items.@slice:{"start":2,"end":-1}`).Raw == `[{"n":3},[4]]`)
+	assert(t, Get(json, `items.@slice:{"start":10,"end":20}`).Raw == `[]`)
+	assert(t, Get(json, `items.@slice:{"start":3,"end":1}`).Raw == `[]`)
+	assert(t, Get(json, `items.@first`).Raw == `[1]`)
+	assert(t, Get(json, `items.@first:2`).Raw == `[1,"two"]`)
+	assert(t, Get(json, `items.@first:20`).Raw == `[1,"two",{"n":3},[4],5]`)
+	assert(t, Get(json, `items.@last:2`).Raw == `[[4],5]`)
+	assert(t, Get(json, `items.@last:0`).Raw == `[]`)
+	assert(t, Get(json, `items.@last:9`).Raw == `[1,"two",{"n":3},[4],5]`)
+	assert(t, Get(json, `items.@skip:3`).Raw == `[[4],5]`)
+	assert(t, Get(json, `items.@skip:3|0`).Raw == `[4]`)
+	assert(t, Get(json, `items.@skip:2|@first:1|0.n`).Int() == 3)
+	var raws []string
+	for _, value := range Get(json, "items").Array() {
+		raws = append(raws, value.Raw)
+	}
+	assert(t, Get(json, `items.@skip:0`).Raw == "["+strings.Join(raws, ",")+"]")
+	assert(t, Get(json, `items.2|@first`).Raw == `{"n":3}`)
+}
+
+func TestModMap(t *testing.T) {
+	json := `{
+		"friends": [
+			{"first": "Dale", "last": "Murphy", "age": 44, "nets": ["ig", "fb", "tw"]},
+			{"first": "Roger", "last": "Craig", "age": 68, "nets": ["fb", "tw"]},
+			{"first": "Jane", "age": 47}
+		],
+		"teams": {"red": {"lead": "Dale", "size": 3}, "blue": {"lead": "Jane"}}
+	}`
+	assert(t, Get(json, `friends.@map:{"name":"first","years":"age"}`).Raw ==
+		`[{"name":"Dale","years":44},{"name":"Roger","years":68},{"name":"Jane","years":47}]`)
+	assert(t, Get(json, `friends.@map:"{first,age}"`).Raw ==
+		`[{"first":"Dale","age":44},{"first":"Roger","age":68},{"first":"Jane","age":47}]`)
+	assert(t, Get(json, `friends.@map:{first,n:nets.#}`).Raw ==
+		`[{"first":"Dale","n":3},{"first":"Roger","n":2},{"first":"Jane"}]`)
+	assert(t, Get(json, `friends.@map:last`).Raw == `["Murphy","Craig"]`)
+	assert(t, Get(json, `friends.@map:"nets|@reverse"`).Raw == `[["tw","fb","ig"],["tw","fb"]]`)
+	assert(t, Get(json, `friends.@map:{"name":"first","last":"last"}|2`).Raw ==
+		`{"name":"Jane"}`)
+	assert(t, Get(json, `teams.@map:{"who":"lead","n":"size"}`).Raw ==
+		`{"red":{"who":"Dale","n":3},"blue":{"who":"Jane"}}`)
+	assert(t, Get(json, `teams.@map:size`).Raw == `{"red":3}`)
+	assert(t, Get(json, `friends.0.first|@map:x`).Raw == `"Dale"`)
+}
+
+func TestModFilter(t *testing.T) {
+	json := `{
+		"flags": {"beta_search": true, "beta_chat": false, "dark_mode": true, "limit": 5},
+		"friends": [
+			{"first": "Dale", "last": "Murphy", "age": 44},
+			{"first": "Roger", "last": "Craig", "age": 68},
+			{"first": "Jane", "last": "Murphy", "age": 47}
+		],
+		"nums": [1, 5, 10, 15]
+	}`
+	assert(t, Get(json, `flags.@filter:{"value":"==true"}`).Raw ==
+		`{"beta_search":true,"dark_mode":true}`)
+	assert(t, Get(json, `flags.@filter:{"key":"beta_*"}`).Raw ==
+		`{"beta_search":true,"beta_chat":false}`)
+	assert(t, Get(json, `flags.@filter:{"key":"beta_*","value":"==true"}|@keys`).Raw ==
+		`["beta_search"]`)
+	assert(t, Get(json, `flags.@filter:{"key":"!%\"beta_*\""}|@keys`).Raw ==
+		`["dark_mode","limit"]`)
+	assert(t, Get(json, `flags.@filter:{"value":">1"}`).Raw == `{"limit":5}`)
+	assert(t, Get(json, `friends.@filter:{"value":"last==\"Murphy\""}|#.first`).Raw ==
+		`["Dale","Jane"]`)
+	assert(t, Get(json, `friends.@filter:age>45|#.first`).Raw == `["Roger","Jane"]`)
+	assert(t, Get(json, `friends.@filter:{"value":"first%\"*e\""}|#.first`).Raw ==
+		`["Dale","Jane"]`)
+	assert(t, Get(json, `nums.@filter:>=10`).Raw == `[10,15]`)
+	assert(t, Get(json, `nums.@filter:{"key":"<2"}`).Raw == `[1,5]`)
+	assert(t, Get(json, `nums.@filter:{"value":"x>1"}`).Raw == `[]`)
+	assert(t, Get(json, `nums.0|@filter:>1`).Raw == `1`)
+	_, err := GetE(json, `nums.@filter:{"value":"(("}`)
+	assert(t, err != nil && err.Error() == `gjson: @filter: invalid value query "(("`)
+	_, err = GetE(json, `flags.@filter:{"key":"==("}`)
+	assert(t, err != nil && err.Error() == `gjson: @filter: invalid key query "==("`)
+	_, err = GetE(json, `nums.@filter:((`)
+	assert(t, err != nil)
+}
+
+func TestModPickOmitRename(t *testing.T) {
+	json := `{"id":1,"name":"Tom","password":"x","token":"y",` +
+		`"friends":[{"id":2,"name":"Jane","token":"z"}],"meta":{"id":3,"token_x":"w"}}`
+	assert(t, Get(json, `@pick:["id","name"]`).Raw == `{"id":1,"name":"Tom"}`)
+	assert(t, Get(json, `@pick:"name"`).Raw == `{"name":"Tom"}`)
+	assert(t, Get(json, `friends.@pick:["name"]`).Raw == `[{"name":"Jane"}]`)
+	assert(t, Get(json, `@pick:{"keys":["id","friends"],"deep":true}`).Raw ==
+		`{"id":1,"friends":[{"id":2}]}`)
+	assert(t, Get(json, `@omit:["password","token*","friends","meta"]`).Raw ==
+		`{"id":1,"name":"Tom"}`)
+	assert(t, Get(json, `@omit:{"keys":["password","token*"],"deep":true}`).Raw ==
+		`{"id":1,"name":"Tom","friends":[{"id":2,"name":"Jane"}],"meta":{"id":3}}`)
+	assert(t, Get(json, `@omit:["password","token*"]|meta`).Raw ==
+		`{"id":3,"token_x":"w"}`)
+	assert(t, Get(json, `meta.@rename:{"id":"meta.id"}`).Raw ==
+		`{"meta.id":3,"token_x":"w"}`)
+	assert(t, Get(json, `@rename:{"keys":{"id":"ID"},"deep":true}|@pick:["ID","friends"]`).Raw ==
+		`{"ID":1,"friends":[{"ID":2,"name":"Jane","token":"z"}]}`)
+	assert(t, Get(json, `name.@pick:["name"]`).Raw == `"Tom"`)
+}
+
+func TestModEntries(t *testing.T) {
+	json := `{"a":1,"b":{"c":[true]},"d\"e":"f"}`
+	entries := `[{"key":"a","value":1},{"key":"b","value":{"c":[true]}},{"key":"d\"e","value":"f"}]`
+	assert(t, Get(json, `@entries`).Raw == entries)
+	assert(t, Get(json, `@entries|@fromentries`).Raw == `{"a":1,"b":{"c":[true]},"d\"e":"f"}`)
+	assert(t, Get(json, `@entries:{"key":"k","value":"v.x"}`).Raw ==
+		`[{"k":"a","v.x":1},{"k":"b","v.x":{"c":[true]}},{"k":"d\"e","v.x":"f"}]`)
+	assert(t, Get(json, `@entries:{"key":"k","value":"v.x"}|@fromentries:{"key":"k","value":"v.x"}`).Raw ==
+		`{"a":1,"b":{"c":[true]},"d\"e":"f"}`)
+	assert(t, Get(json, `@entries|#(key!="b")#|@fromentries`).Raw == `{"a":1,"d\"e":"f"}`)
+	assert(t, Get(`[{"key":1,"value":2},{"key":"x"},{"value":3},4]`, `@fromentries`).Raw ==
+		`{"1":2,"x":null}`)
+	assert(t, Get(`[1,2]`, `@entries`).Raw == `[1,2]`)
+	assert(t, Get(`{}`, `@entries`).Raw == `[]`)
+}
+
+func TestModFlattenObj(t *testing.T) {
+	json := `{"a":{"b":[1,2]},"c.d":{"e":"f"},"g":{ },"h":[],"i":null}`
+	flat := `{"a.b.0":1,"a.b.1":2,"c\\.d.e":"f","g":{ },"h":[],"i":null}`
+	assert(t, Get(json, `@flattenobj`).Raw == flat)
+	assert(t, Get(json, `@flattenobj|@unflatten`).Raw ==
+		`{"a":{"b":[1,2]},"c.d":{"e":"f"},"g":{ },"h":[],"i":null}`)
+	for key := range Get(json, `@flattenobj`).Keys() {
+		assert(t, Get(json, key.String()).Exists())
+	}
+	assert(t, Get(json, `@flattenobj:{"sep":"/"}`).Raw ==
+		`{"a/b/0":1,"a/b/1":2,"c.d/e":"f","g":{ },"h":[],"i":null}`)
+	assert(t, Get(json, `@flattenobj:{"sep":"/"}|@unflatten:{"sep":"/"}`).Raw ==
+		`{"a":{"b":[1,2]},"c.d":{"e":"f"},"g":{ },"h":[],"i":null}`)
+	assert(t, Get(`[1,[2,{"x":3}]]`, `@flattenobj`).Raw == `{"0":1,"1.0":2,"1.1.x":3}`)
+	assert(t, Get(`[1,[2,{"x":3}]]`, `@flattenobj|@unflatten`).Raw == `[1,[2,{"x":3}]]`)
+	assert(t, Get(`{"a.1":1,"a.2":2}`, `@unflatten`).Raw == `{"a":{"1":1,"2":2}}`)
+	assert(t, Get(`{"a.b":1,"a":2,"a.c":3}`, `@unflatten`).Raw == `{"a":{"c":3}}`)
+	assert(t, Get(`{}`, `@unflatten`).Raw == `{}`)
+	assert(t, Get(`"a"`, `@flattenobj`).Raw == `"a"`)
+	assert(t, Get(`{}`, `@flattenobj`).Raw == `{}`)
+	assert(t, Get(`{}`, `@flattenobj|@unflatten`).Raw == `{}`)
+	assert(t, Get(` [ ] `, `@flattenobj`).Raw == `{}`)
+	assert(t, Get(`{"":{}}`, `@flattenobj`).Raw == `{"":{}}`)
+	json = `{"":{"b":1,"":{"":2}},"b":2}`
+	assert(t, Get(json, `@flattenobj`).Raw == `{".b":1,"..":2,"b":2}`)
+	assert(t, Get(json, `@flattenobj|@unflatten`).Raw == json)
+	assert(t, Get(json, `@flattenobj:{"sep":"/"}`).Raw == `{"/b":1,"//":2,"b":2}`)
+	assert(t, Get(`[{"":1}]`, `@flattenobj`).Raw == `{"0.":1}`)
+}
+
+func TestModStrings(t *testing.T) {
+	json := `{"name":"  Tom \"T\" Anderson ","tags":["Go","JSON",1],"csv":"a,b,,c","emoji":"héllo 🌍!"}`
+	assert(t, Get(json, `name.@lower`).Raw == `"  tom \"t\" anderson "`)
+	assert(t, Get(json, `name.@upper|@trim`).Raw == `"TOM \"T\" ANDERSON"`)
+	assert(t, Get(json, `tags.@lower`).Raw == `["go","json",1]`)
+	assert(t, Get(json, `tags.@upper|@concat`).Raw == `"GOJSON1"`)
+	assert(t, Get(json, `tags.@concat:", "`).Raw == `"Go, JSON, 1"`)
+	assert(t, Get(json, `tags.@concat:"|"`).Raw == `"Go|JSON|1"`)
+	assert(t, Get(json, `csv.@split:","`).Raw == `["a","b","","c"]`)
+	assert(t, Get(json, `csv.@split:,|#`).Int() == 4)
+	assert(t, Get(json, `tags.@split:"O"`).Raw == `[["Go"],["JS","N"],1]`)
+	assert(t, Get(json, `csv.@replace:{"old":",","new":"; "}`).Raw == `"a; b; ; c"`)
+	assert(t, Get(json, `csv.@replace:{"old":",","new":"","n":1}`).Raw == `"ab,,c"`)
+	assert(t, Get(json, `emoji.@substr:{"start":1,"len":4}`).String() == "éllo")
+	assert(t, Get(json, `emoji.@substr:{"start":-2}`).String() == "🌍!")
+	assert(t, Get(json, `emoji.@substr:{"start":6,"len":1}`).String() == "🌍")
+	assert(t, Get(json, `emoji.@substr:{"start":20}`).Raw == `""`)
+	assert(t, Get(json, `tags.@substr:{"len":1}`).Raw == `["G","J",1]`)
+	assert(t, Get(json, `emoji.@trim:"h!"|@upper`).String() == "ÉLLO 🌍")
+	assert(t, Get(`"<a>"`, `@upper`).String() == "<A>")
+	assert(t, Get(`{"a":"b"}`, `@upper`).Raw == `{"a":"b"}`)
+}
+
+func TestModEncoding(t *testing.T) {
+	payload := `{"id":1023,"name":"alert"}`
+	b64 := base64.StdEncoding.EncodeToString([]byte(payload))
+	json := `{"msg":"` + b64 + `","url":"` + base64.URLEncoding.EncodeToString([]byte("??>>")) + `"}`
+	assert(t, Get(json, `msg.@unbase64`).String() == payload)
+	assert(t, Get(json, `msg.@unbase64|@fromstr|name`).String() == "alert")
+	assert(t, Get(json, `url.@unbase64`).String() == "??>>")
+	assert(t, Get(json, `url.@unbase64:url`).String() == "??>>")
+	assert(t, !Get(json, `url.@unbase64:std`).Exists())
+	assert(t, Get(`"??>>"`, `@base64:url`).String() == "Pz8-Pg==")
+	assert(t, Get(`"??>>"`, `@base64:rawurl`).String() == "Pz8-Pg")
+	assert(t, Get(`"hello"`, `@base64`).String() == "aGVsbG8=")
+	assert(t, Get(`{"a":[1,2]}`, `@base64|@unbase64|@fromstr|a.1`).Int() == 2)
+	assert(t, Get(`"hi"`, `@hex`).String() == "6869")
+	assert(t, Get(`[1]`, `@hex`).String() == "5b315d")
+	assert(t, Get(`"a b&c=ü"`, `@urlencode`).String() == "a+b%26c%3D%C3%BC")
+	assert(t, Get(`"a+b%26c%3D%C3%BC"`, `@urldecode`).String() == "a b&c=ü")
+	assert(t, !Get(`"%zz"`, `@urldecode`).Exists())
+	sum := sha256.Sum256([]byte(`"hello"`))
+	assert(t, Get(`"hello"`, `@sha256`).String() == hex.EncodeToString(sum[:]))
+	sum = sha256.Sum256([]byte(`{"a":1,"b":2}`))
+	assert(t, Get(`{"b":2.0, "a":1}`, `@sha256`).String() == hex.EncodeToString(sum[:]))
+	md := md5.Sum([]byte(`"hello"`))
+	assert(t, Get(`"hello"`, `@md5`).String() == hex.EncodeToString(md[:]))
+	assert(t, Get(`"h\u0065llo"`, `@md5`).String() == hex.EncodeToString(md[:]))
+	assert(t, Get(`"hello"`, `@crc32`).String() ==
+		fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(`"hello"`))))
+	assert(t, Get(`[1,{"x":1,"y":2}]`, `@crc32`).String() ==
+		Get(`[1.0,{"y":2,"x":1}]`, `@crc32`).String())
+	for _, mod := range []string{`@sha256`, `@md5`, `@crc32`} {
+		for _, pair := range [][2]string{
+			{`"1"`, `1`}, {`"true"`, `true`}, {`"null"`, `null`},
+		} {
+			assert(t, Get(pair[0], mod).String() != Get(pair[1], mod).String())
+		}
+	}
+}
+
+func TestModIntrospection(t *testing.T) {
+	json := `{"name":"Zoë","age":37,"ok":true,"no":false,"nil":null,"tags":["a","b"],"obj":{"a":1,"b":2,"c":3}}`
+	for path, typ := range map[string]string{
+		"name": "string", "age": "number", "ok": "boolean", "no": "boolean",
+		"nil": "null", "tags": "array", "obj": "object",
+	} {
+		assert(t, Get(json, path+".@type").String() == typ)
+	}
+	assert(t, !Get(json, "missing.@type").Exists())
+	assert(t, Get(json, "name.@len").Int() == 3)
+	assert(t, Get(json, "tags.@len").Int() == 2)
+	assert(t, Get(json, "obj.@len").Int() == 3)
+	assert(t, !Get(json, "age.@len").Exists())
+	assert(t, Get(json, `{hasName:name.@exists,hasEmail:email.@exists,nil:nil.@isnull,age:age.@isnull,x:x.@isnull}`).Raw ==
+		`{"hasName":true,"hasEmail":false,"nil":true,"age":false,"x":false}`)
+	assert(t, Get(json, `obj.d.@exists`).Raw == `false`)
+	assert(t, Get(json, `tags.5|@exists`).Raw == `false`)
+	assert(t, Get(json, `tags.#.@type`).Raw == `["string","string"]`)
+}
+
+func TestModDefaultCoalesce(t *testing.T) {
+	json := `{"name":"Tom","nick":null,"contact":{"email":"tom@example.com"},"age":0}`
+	assert(t, Get(json, `name.@default:"n/a"`).String() == "Tom")
+	assert(t, Get(json, `nick.@default:"n/a"`).String() == "n/a")
+	assert(t, Get(json, `email.@default:"n/a"`).String() == "n/a")
+	assert(t, Get(json, `email.@default:n/a`).String() == "n/a")
+	assert(t, Get(json, `age.@default:10`).Int() == 0)
+	assert(t, Get(json, `size.@default:10`).Int() == 10)
+	assert(t, Get(json, `tags.@default:[]|#`).Int() == 0)
+	assert(t, Get(json, `{name,nick:nick.@default:"n/a",email:email.@default:null,age}`).Raw ==
+		`{"name":"Tom","nick":"n/a","email":null,"age":0}`)
+	assert(t, Get(json, `@coalesce:["email","contact.email"]`).String() == "tom@example.com")
+	assert(t, Get(json, `@coalesce:["nick","name"]`).Raw == `null`)
+	assert(t, !Get(json, `@coalesce:["x","y"]`).Exists())
+	assert(t, Get(json, `{email:@coalesce:["email","contact.email"],x:@coalesce:["x"]}`).Raw ==
+		`{"email":"tom@example.com"}`)
+	assert(t, Get(json, `@coalesce:["x","y"]|@default:"none"`).String() == "none")
+}
+
+func TestModGroupBy(t *testing.T) {
+	json := `{"staff":[
+		{"name":"Tom","dept":"eng","salary":100},
+		{"name":"Jane","dept":"ops","salary":80},
+		{"name":"Dale","dept":"eng","salary":120.5},
+		{"name":"Roger","salary":50},
+		{"name":"Ann","dept":"ops","salary":"90"}
+	]}`
+	assert(t, Get(json, `staff.@groupby:{"key":"dept","agg":{"total":"sum:salary","n":"count","top":"max:salary"}}`).Raw ==
+		`[{"dept":"eng","total":220.5,"n":2,"top":120.5},{"dept":"ops","total":80,"n":2,"top":"90"},{"total":50,"n":1,"top":50}]`)
+	assert(t, Get(json, `staff.@groupby:{"key":"dept","agg":{"total":"sum:{\"path\":\"salary\",\"policy\":\"fail\"}"}}`).Raw ==
+		`[{"dept":"eng","total":220.5},{"dept":"ops"},{"total":50}]`)
+	assert(t, Get(`[{"k":null},{},{"k":null},{"x":1}]`, `@groupby:{"key":"k","agg":{"n":"count"}}`).Raw ==
+		`[{"k":null,"n":2},{"n":2}]`)
+	for _, json := range []string{`[1]`, `[]`, `{}`} {
+		_, err := GetE(json, `@groupby:{"key":"k","agg":{"n":"count","x":"nope:1"}}`)
+		assert(t, err != nil && err.Error() ==
+			`gjson: @groupby: arg "agg" has unknown modifier "nope"`)
+	}
+	assert(t, Get(json, `staff.@groupby:{"key":"dept","agg":{"names":"map:name"}}|#(dept="ops").names`).Raw ==
+		`["Jane","Ann"]`)
+	assert(t, Get(json, `staff.@groupby:{"key":"dept"}|1.items.#.name`).Raw == `["Jane","Ann"]`)
+	assert(t, Get(`[{"a":{"b":1}},{"a":{"b":1.0}},{"a":{"b":2}}]`, `@groupby:{"key":"a.b","agg":{"n":"count"}}`).Raw ==
+		`[{"b":1,"n":2},{"b":2,"n":1}]`)
+	assert(t, Get(`[1,2,1]`, `@groupby:{"agg":{"n":"count"}}`).Raw == `[{"key":1,"n":2},{"key":2,"n":1}]`)
+	assert(t, Get(`{"a":1}`, `@groupby:{"key":"a"}`).Raw == `{"a":1}`)
+}
+
+func TestModZipChunkWindow(t *testing.T) {
+	json := `{"ts":[1, 2, 3],"vals":["a","b",{"c":1}],"short":[true]}`
+	assert(t, Get(json, `[ts,vals]|@zip`).Raw == `[[1,"a"],[2,"b"],[3,{"c":1}]]`)
+	assert(t, Get(json, `[ts,vals,short]|@zip`).Raw == `[[1,"a",true]]`)
+	assert(t, Get(`[]`, `@zip`).Raw == `[]`)
+	for _, json := range []string{`[[1,2],5]`, `[[1,2],null]`, `[{"a":1}]`} {
+		_, err := GetE(json, `@zip`)
+		assert(t, err != nil && strings.HasPrefix(err.Error(), `gjson: @zip: element `))
+	}
+	_, err := GetE(`[[1,2],[3],"ab"]`, `@zip`)
+	assert(t, err != nil && err.Error() == `gjson: @zip: element 2 is not an array`)
+	assert(t, Get(json, `ts.@chunk:2`).Raw == `[[1,2],[3]]`)
+	assert(t, Get(json, `vals.@chunk:3`).Raw == `[["a","b",{"c":1}]]`)
+	_, err = GetE(json, `ts.@chunk:0`)
+	assert(t, err != nil && err.Error() == `gjson: @chunk: arg "size" must be at least 1`)
+	assert(t, Get(`[1,2,3,4]`, `@window:{"size":3}`).Raw == `[[1,2,3],[2,3,4]]`)
+	assert(t, Get(`[1,2,3,4,5]`, `@window:{"size":2,"step":2}`).Raw == `[[1,2],[3,4]]`)
+	assert(t, Get(`[1,2]`, `@window:{"size":3}`).Raw == `[]`)
+	assert(t, Get(`[1,2,3,4]`, `@window:{"size":2}|#.@sum`).Raw == `[3,5,7]`)
+}
+
+func TestModBadArgs(t *testing.T) {
+	for _, test := range []struct{ path, err string }{
+		{`@sort:{"desc":"yes"}`, `arg "desc" must be a bool`},
+		{`@sum:{"policy":"nope"}`, `arg "policy" must be "skip", "coerce", or "fail"`},
+		{`@slice:{"start":"x"}`, `arg "start" must be an integer`},
+		{`@first:-1`, `arg "n" must be at least 0`},
+		{`@last:x`, `arg "n" must be an integer`},
+		{`@skip:1,2`, `too many args, expected at most 1`},
+		{`@filter:{"value":1}`, `arg "value" must be a string`},
+		{`@pick:{"deep":true}`, `arg "keys" is required`},
+		{`@omit:a,1`, `arg "deep" must be a bool`},
+		{`@rename:["a"]`, `arg "keys" must be an object`},
+		{`@rename:{"a":1}`, `arg "keys" must have string values`},
+		{`@entries:{"key":1}`, `arg "key" must be a string`},
+		{`@flattenobj:{"sep":""}`, `arg "sep" must not be empty`},
+		{`@unflatten:{"sep":1}`, `arg "sep" must be a string`},
+		{`@upper:x`, `too many args, expected at most 0`},
+		{`@replace:{"new":"x"}`, `arg "old" is required`},
+		{`@substr:{"len":"2"}`, `arg "len" must be an integer`},
+		{`@base64:hex`, `arg "encoding" must be "std", "url", "rawstd", or "rawurl"`},
+		{`@sha256:1`, `too many args, expected at most 0`},
+		{`@coalesce`, `arg "paths" is required`},
+		{`@groupby:{"agg":["count"]}`, `arg "agg" must be an object`},
+		{`@groupby:{"agg":{"n":1}}`, `arg "agg" must have string values`},
+		{`@zip:1`, `too many args, expected at most 0`},
+		{`@chunk:abc`, `arg "size" must be an integer`},
+		{`@window:{"size":2,"step":0}`, `arg "step" must be at least 1`},
+		{`@window`, `arg "size" is required`},
+	} {
+		_, err := GetE(`[1,2,3]`, test.path)
+		name, _, _ := strings.Cut(test.path[1:], ":")
+		expect := "gjson: @" + name + ": " + test.err
+		if err == nil || err.Error() != expect {
+			t.Fatalf("%s: expected %q, got %v", test.path, expect, err)
+		}
+	}
+}
+
+func TestEngine(t *testing.T) {
+	json := `{"name":"Tom","friends":[{"first":"Dale"},{"first":"Jane"}]}`
+	e1 := NewEngine(Config{})
+	e2 := NewEngine(Config{})
+	e1.AddModifier("shout", func(json, arg string) string {
+		return strings.ToUpper(json)
+	})
+	assert(t, e1.ModifierExists("shout"))
+	assert(t, !e2.ModifierExists("shout"))
+	assert(t, !ModifierExists("shout", nil))
+	assert(t, e1.Get(json, "name.@shout").String() == "TOM")
+	assert(t, e1.Get(json, "friends.#.first.@shout").Raw == `["DALE","JANE"]`)
+	assert(t, e1.Get(json, "friends.#(first=Jane).first|@shout").Raw == `"JANE"`)
+	assert(t, e1.Get(json, "{a:name.@shout}").Raw == `{"a":"TOM"}`)
+	assert(t, !e2.Get(json, "name.@shout").Exists())
+	assert(t, !Get(json, "name.@shout").Exists())
+	assert(t, e2.Get(json, "friends.@reverse.0.first").String() == "Jane")
+	assert(t, e1.GetBytes([]byte(json), "name.@shout").String() == "TOM")
+	res := e1.GetMany(json, "name.@shout", "friends.#")
+	assert(t, res[0].String() == "TOM" && res[1].Int() == 2)
+	res = e1.GetManyBytes([]byte(json), "name.@shout", "friends.#")
+	assert(t, res[0].String() == "TOM" && res[1].Int() == 2)
+
+	e3 := NewEngine(Config{DisableModifiers: true, DisableLiterals: true})
+	assert(t, !e3.Get(json, "friends.@reverse").Exists())
+	assert(t, !e3.Get(json, "!true").Exists())
+	assert(t, e3.Get(json, "{a:name,b:!true}").Raw == `{"a":"Tom"}`)
+	assert(t, Get(json, "{a:name,b:!true}").Raw == `{"a":"Tom","b":true}`)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("mod%d", i)
+			e1.AddModifier(name, func(json, arg string) string {
+				return strconv.Itoa(i)
+			})
+			for j := 0; j < 100; j++ {
+				assert(t, e1.Get(json, "name.@"+name).Int() == int64(i))
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestModifierFunc(t *testing.T) {
+	json := `{"name":"Tom","age":"37","friends":[{"first":"Dale","age":44},{"first":"Jane"}]}`
+	errMissing := errors.New("missing value")
+	e := NewEngine(Config{DisableLiterals: true})
+	var lastCtx ModContext
+	e.AddModifierFunc("must", func(ctx ModContext, json, arg string) (string, error) {
+		lastCtx = ctx
+		if !Parse(json).Exists() {
+			return "", errMissing
+		}
+		return json, nil
+	})
+	res, err := e.GetE(json, "name.@must")
+	assert(t, err == nil && res.String() == "Tom")
+	assert(t, lastCtx.Root == json && lastCtx.Path == "name")
+	assert(t, lastCtx.Engine == e && lastCtx.Engine.Config().DisableLiterals)
+
+	res, err = e.GetE(json, "email.@must")
+	assert(t, !res.Exists() && errors.Is(err, errMissing))
+	var merr *ModifierError
+	assert(t, errors.As(err, &merr) && merr.Name == "must")
+	assert(t, err.Error() == "gjson: @must: missing value")
+	assert(t, !e.Get(json, "email.@must").Exists())
+
+	_, err = e.GetE(json, "{name,email:email.@must}")
+	assert(t, errors.Is(err, errMissing))
+	_, err = e.GetE(json, "friends.#.first.@must")
+	assert(t, err == nil)
+	_, err = e.GetE(json, "friends.#.age.@must")
+	assert(t, errors.Is(err, errMissing))
+	_, err = e.GetE(json, "friends.@map:age.@must")
+	assert(t, errors.Is(err, errMissing))
+	_, err = e.GetE(json, `friends.@groupby:{"key":"first","agg":{"a":"must"}}`)
+	assert(t, err == nil)
+	_, err = e.GetE(json, `@dig:age|@must`)
+	assert(t, err == nil)
+	_, err = e.GetE(json, `@dig:age.@must`)
+	assert(t, errors.Is(err, errMissing))
+	_, err = e.GetBytesE([]byte(json), "email.@must")
+	assert(t, errors.Is(err, errMissing))
+	res, err = e.GetE(json, "friends.@map:first|@reverse")
+	assert(t, err == nil && res.Raw == `["Jane","Dale"]`)
+	_, err = GetE(json, "email.@must")
+	assert(t, err == nil)
+
+	AddModifierFunc("nonempty", func(ctx ModContext, json, arg string) (string, error) {
+		if Parse(json).String() == "" {
+			return "", errors.New("empty")
+		}
+		return json, nil
+	})
+	defer RemoveModifier("nonempty")
+	_, err = GetE(`{"a":""}`, "a.@nonempty")
+	assert(t, err != nil && err.Error() == "gjson: @nonempty: empty")
+}
+
+func TestModContextPath(t *testing.T) {
+	json := `{"name":"Tom","friends":[{"first":"Dale","age":44},` +
+		`{"first":"Jane","age":68}],"a.b":[1]}`
+	e := NewEngine(Config{})
+	var paths []string
+	var roots []string
+	e.AddModifierFunc("path", func(ctx ModContext, json, arg string) (string, error) {
+		paths = append(paths, ctx.Path)
+		roots = append(roots, ctx.Root)
+		return json, nil
+	})
+	for _, test := range []struct {
+		path   string
+		expect []string
+	}{
+		{"@path", []string{"@this"}},
+		{"name.@path", []string{"name"}},
+		{"name|@path", []string{"name"}},
+		{"friends.0.first.@path", []string{"friends.0.first"}},
+		{`a\.b.0.@path`, []string{`a\.b.0`}},
+		{"friends.#.first.@path", []string{"friends.0.first", "friends.1.first"}},
+		{"friends.#.@path", []string{"friends.0", "friends.1"}},
+		{"friends.#.first|@path", []string{"friends.#.first"}},
+		{"friends.#(age>50).first.@path", []string{"friends.1.first"}},
+		{"friends.#(first.@path==Jane)", []string{"friends.0.first",
+			"friends.1.first"}},
+		{"friends|@reverse|0.first.@path", []string{"friends|@reverse|0.first"}},
+		{"[name.@path,friends.0.age.@path]", []string{"name",
+			"friends.0.age"}},
+		{"friends.[0.@path]", []string{"friends|0"}},
+		{"[name,friends]|@path", []string{"[name,friends]"}},
+		{"friends.#.[first.@path]", []string{"friends.0|first",
+			"friends.1|first"}},
+	} {
+		paths = nil
+		_, err := e.GetE(json, test.path)
+		assert(t, err == nil)
+		if strings.Join(paths, " ") != strings.Join(test.expect, " ") {
+			t.Fatalf("%s: expected %q, got %q", test.path, test.expect, paths)
+		}
+		// the paths return the json of the modifier
+		for _, path := range paths {
+			res := Get(json, path)
+			assert(t, res.Exists())
+		}
+	}
+	// a path of a modifier starts at the json of ModContext.Get
+	paths, roots = nil, nil
+	_, err := e.GetE(json, "friends.@map:first.@path")
+	assert(t, err == nil && len(paths) == 2 && paths[0] == "first" &&
+		roots[0] == `{"first":"Dale","age":44}`)
+}
+
+type testPadArgs struct {
+	Width int    `gjson:"width,required,min=0"`
+	Fill  string `gjson:"fill"`
+}
+
+type testRangeArgs struct {
+	Start  int
+	End    int `gjson:"end"`
+	Labels []string
+	Ratio  float64 `gjson:"ratio,max=1"`
+	On     bool
+	Raw    Result
+	Any    interface{}
+	hidden int
+	Skip   int `gjson:"-"`
+}
+
+func (args *testRangeArgs) Validate() error {
+	if args.End < args.Start {
+		return errors.New("end before start")
+	}
+	return nil
+}
+
+func TestParseArgs(t *testing.T) {
+	args := testPadArgs{Fill: " "}
+	assert(t, ParseArgs(`8`, &args) == nil && args.Width == 8 && args.Fill == " ")
+	assert(t, ParseArgs(`8,"0"`, &args) == nil && args.Width == 8 && args.Fill == "0")
+	assert(t, ParseArgs(` 9 , x `, &args) == nil && args.Width == 9 && args.Fill == "x")
+	assert(t, ParseArgs(`{"width":3,"fill":"-"}`, &args) == nil && args.Width == 3 && args.Fill == "-")
+	assert(t, ParseArgs(`{"WIDTH":4}`, &args) == nil && args.Width == 4)
+	err := ParseArgs(`{"fill":"-"}`, &args)
+	assert(t, err != nil && err.Error() == `gjson: arg "width" is required`)
+	err = ParseArgs(`-1`, &args)
+	assert(t, err != nil && err.Error() == `gjson: arg "width" must be at least 0`)
+	err = ParseArgs(`"8"`, &args)
+	assert(t, err != nil && err.Error() == `gjson: arg "width" must be an integer`)
+	err = ParseArgs(`1.5`, &args)
+	assert(t, err != nil)
+	err = ParseArgs(`1,2,3`, &args)
+	assert(t, err != nil && err.Error() == `gjson: too many args, expected at most 2`)
+	assert(t, ParseArgs(``, &args) != nil)
+	assert(t, ParseArgs(`1`, args) != nil)
+
+	var rargs testRangeArgs
+	assert(t, ParseArgs(`{"start":1,"end":5,"labels":["a","b"],"ratio":0.5,`+
+		`"on":true,"raw":{"x":[1]},"any":[1,"2"],"skip":7}`, &rargs) == nil)
+	assert(t, rargs.Start == 1 && rargs.End == 5 && rargs.Ratio == 0.5 && rargs.On)
+	assert(t, len(rargs.Labels) == 2 && rargs.Labels[1] == "b")
+	assert(t, rargs.Raw.Get("x.0").Int() == 1 && rargs.Skip == 0)
+	assert(t, fmt.Sprint(rargs.Any) == "[1 2]")
+	rargs = testRangeArgs{}
+	assert(t, ParseArgs(`2,3,"a",0.25,true`, &rargs) == nil)
+	assert(t, rargs.Start == 2 && rargs.End == 3 && rargs.Labels[0] == "a" && rargs.On)
+	err = ParseArgs(`{"start":5,"end":1}`, &rargs)
+	assert(t, err != nil && err.Error() == "end before start")
+	err = ParseArgs(`{"ratio":2}`, &testRangeArgs{})
+	assert(t, err != nil && err.Error() == `gjson: arg "ratio" must be at most 1`)
+	err = ParseArgs(`{"labels":[1]}`, &testRangeArgs{})
+	assert(t, err != nil && err.Error() == `gjson: arg "Labels" must be a string`)
+	assert(t, ParseArgs(`[1,2],{"a":"b,c"}`, &struct {
+		A []int
+		B Result
+	}{}) == nil)
+}
+
+func TestModifiers(t *testing.T) {
+	e := NewEngine(Config{})
+	infos := e.Modifiers()
+	assert(t, len(infos) == len(builtinModifierInfos()))
+	for i, info := range infos {
+		assert(t, info.Builtin && info.Description != "")
+		assert(t, i == 0 || infos[i-1].Name < info.Name)
+		assert(t, e.ModifierExists(info.Name))
+	}
+	var window ModifierInfo
+	for _, info := range infos {
+		if info.Name == "window" {
+			window = info
+		}
+	}
+	assert(t, len(window.Args) == 2 && window.Args[0].Name == "size" &&
+		window.Args[0].Type == "number" && window.Args[0].Required)
+
+	e.AddModifierInfo(ModifierInfo{
+		Name:        "twice",
+		Description: "Repeat a string.",
+		Args:        []ModifierArg{{Name: "sep", Type: "string"}},
+		Builtin:     true,
+	}, func(ctx ModContext, json, arg string) (string, error) {
+		s := Parse(json).String()
+		return string(AppendJSONString(nil, s+arg+s)), nil
+	})
+	e.AddModifier("upper", func(json, arg string) string { return json })
+	e.RemoveModifier("reverse")
+	infos = e.Modifiers()
+	for _, info := range infos {
+		switch info.Name {
+		case "twice":
+			assert(t, !info.Builtin && info.Description == "Repeat a string.")
+			assert(t, len(info.Args) == 1)
+			info.Args[0].Name = "changed"
+		case "upper":
+			assert(t, !info.Builtin && info.Description == "")
+		case "reverse":
+			t.Fatal("reverse was removed")
+		}
+	}
+	for _, info := range e.Modifiers() {
+		if info.Name == "twice" {
+			assert(t, info.Args[0].Name == "sep")
+		}
+	}
+	assert(t, e.Get(`"ab"`, `@twice:-`).String() == "ab-ab")
+	assert(t, e.Get(`"ab"`, `@upper`).String() == "ab")
+	assert(t, !e.Get(`[1,2]`, `@reverse`).Exists())
+	assert(t, Get(`[1,2]`, `@reverse`).Raw == `[2,1]`)
+	AddModifierInfo(ModifierInfo{Name: "testinfo", Description: "Test."},
+		func(ctx ModContext, json, arg string) (string, error) {
+			return json, nil
+		})
+	var found bool
+	for _, info := range Modifiers() {
+		found = found || (info.Name == "testinfo" && info.Description == "Test.")
+	}
+	assert(t, found && ModifierExists("testinfo", nil))
+	RemoveModifier("testinfo")
+	assert(t, !ModifierExists("testinfo", nil))
+}
+
+// TestModifierArgs checks that every documented option of the built-in
+// modifiers changes the result, using the object form unless the modifier is
+// positional.
+func TestModifierArgs(t *testing.T) {
+	tests := []struct {
+		name, opt, json, arg, expect string
+	}{
+		{"pretty", "sortKeys", `{"b":1,"a":2}`, `{"sortKeys":true}`, "{\n  \"a\": 2,\n  \"b\": 1\n}\n"},
+		{"pretty", "indent", `{"a":1}`, `{"indent":"\t"}`, "{\n\t\"a\": 1\n}\n"},
+		{"pretty", "prefix", `{"a":1}`, `{"prefix":" "}`, "{\n   \"a\": 1\n }\n"},
+		{"pretty", "width", `[1,2]`, `{"width":3}`, "[\n  1,\n  2\n]\n"},
+		{"flatten", "deep", `[1,[2,[3]]]`, `{"deep":true}`, `[1,2,3]`},
+		{"join", "preserve", `[{"a":1},{"a":2}]`, `{"preserve":true}`, `{"a":1,"a":2}`},
+		{"dig", "path", `{"a":{"b":1}}`, `b`, `[1]`},
+		{"sort", "by", `[{"a":2},{"b":0,"a":1}]`, `{"by":"a"}`, `[{"b":0,"a":1},{"a":2}]`},
+		{"sort", "desc", `[1,3,2]`, `{"desc":true}`, `[3,2,1]`},
+		{"sort", "caseSensitive", `["b","A","a","B"]`, `{"caseSensitive":false}`, `["A","a","b","B"]`},
+		{"sum", "path", `[{"a":1},{"a":2}]`, `{"path":"a"}`, `3`},
+		{"sum", "policy", `["1",2]`, `{"policy":"coerce"}`, `3`},
+		{"avg", "path", `[{"a":1},{"a":2}]`, `{"path":"a"}`, `1.5`},
+		{"avg", "policy", `["1",2]`, `{"policy":"coerce"}`, `1.5`},
+		{"min", "path", `[{"a":1},{"a":2}]`, `{"path":"a"}`, `1`},
+		{"min", "policy", `["1",2]`, `{"policy":"coerce"}`, `1`},
+		{"max", "path", `[{"a":1},{"a":2}]`, `{"path":"a"}`, `2`},
+		{"max", "policy", `["3",2]`, `{"policy":"coerce"}`, `3`},
+		{"count", "path", `[{"a":1},{}]`, `{"path":"a"}`, `1`},
+		{"unique", "path", `[{"a":1},{"a":1,"b":2}]`, `a`, `[{"a":1}]`},
+		{"slice", "start", `[1,2,3]`, `{"start":1}`, `[2,3]`},
+		{"slice", "end", `[1,2,3]`, `{"end":1}`, `[1]`},
+		{"first", "n", `[1,2,3]`, `{"n":2}`, `[1,2]`},
+		{"last", "n", `[1,2,3]`, `{"n":2}`, `[2,3]`},
+		{"skip", "n", `[1,2,3]`, `{"n":2}`, `[3]`},
+		{"map", "path", `[{"a":1}]`, `a`, `[1]`},
+		{"filter", "value", `[1,2,3]`, `{"value":">1"}`, `[2,3]`},
+		{"filter", "key", `{"a":1,"b":2}`, `{"key":"a"}`, `{"a":1}`},
+		{"pick", "keys", `{"a":1,"b":2}`, `{"keys":["a"]}`, `{"a":1}`},
+		{"pick", "deep", `{"a":{"a":1,"b":2}}`, `{"keys":["a"],"deep":true}`, `{"a":{"a":1}}`},
+		{"omit", "keys", `{"a":1,"b":2}`, `{"keys":["a"]}`, `{"b":2}`},
+		{"omit", "deep", `{"b":{"a":1,"b":2}}`, `{"keys":["a"],"deep":true}`, `{"b":{"b":2}}`},
+		{"rename", "keys", `{"a":1}`, `{"keys":{"a":"b"}}`, `{"b":1}`},
+		{"rename", "deep", `{"a":{"a":1}}`, `{"keys":{"a":"b"},"deep":true}`, `{"b":{"b":1}}`},
+		{"entries", "key", `{"a":1}`, `{"key":"k"}`, `[{"k":"a","value":1}]`},
+		{"entries", "value", `{"a":1}`, `{"value":"v"}`, `[{"key":"a","v":1}]`},
+		{"fromentries", "key", `[{"k":"a","value":1}]`, `{"key":"k"}`, `{"a":1}`},
+		{"fromentries", "value", `[{"key":"a","v":1}]`, `{"value":"v"}`, `{"a":1}`},
+		{"flattenobj", "sep", `{"a":{"b":1}}`, `{"sep":"/"}`, `{"a/b":1}`},
+		{"unflatten", "sep", `{"a/b":1}`, `{"sep":"/"}`, `{"a":{"b":1}}`},
+		{"trim", "cutset", `"xax"`, `x`, `"a"`},
+		{"split", "sep", `"a-b"`, `-`, `["a","b"]`},
+		{"replace", "old", `"a-b-c"`, `{"old":"-"}`, `"abc"`},
+		{"replace", "new", `"a-b-c"`, `{"old":"-","new":"_"}`, `"a_b_c"`},
+		{"replace", "n", `"a-b-c"`, `{"old":"-","new":"_","n":1}`, `"a_b-c"`},
+		{"substr", "start", `"hello"`, `{"start":1}`, `"ello"`},
+		{"substr", "len", `"hello"`, `{"len":2}`, `"he"`},
+		{"concat", "sep", `["a","b"]`, `-`, `"a-b"`},
+		{"base64", "encoding", `"??>"`, `{"encoding":"url"}`, `"Pz8-"`},
+		{"unbase64", "encoding", `"Pz8-"`, `{"encoding":"std"}`, ``},
+		{"default", "value", `null`, `1`, `1`},
+		{"coalesce", "paths", `{"b":1}`, `{"paths":["a","b"]}`, `1`},
+		{"groupby", "key", `[{"a":1},{"a":1}]`, `{"key":"a"}`, `[{"a":1,"items":[{"a":1},{"a":1}]}]`},
+		{"groupby", "agg", `[{"a":1},{"a":1}]`, `{"key":"a","agg":{"n":"count"}}`, `[{"a":1,"n":2}]`},
+		{"chunk", "size", `[1,2,3]`, `{"size":2}`, `[[1,2],[3]]`},
+		{"window", "size", `[1,2,3]`, `{"size":2}`, `[[1,2],[2,3]]`},
+		{"window", "step", `[1,2,3]`, `{"size":1,"step":2}`, `[[1],[3]]`},
+	}
+	infos := make(map[string]ModifierInfo)
+	for _, info := range Modifiers() {
+		infos[info.Name] = info
+	}
+	tested := make(map[string]bool)
+	for _, test := range tests {
+		// positional modifiers take the value of the option, and all other
+		// modifiers take an object of options
+		opts := Parse(test.arg)
+		if infos[test.name].Positional == opts.IsObject() ||
+			(opts.IsObject() && !opts.Get(test.opt).Exists()) {
+			t.Fatalf("@%s: %s has the wrong form", test.name, test.arg)
+		}
+		res, _ := GetE(test.json, "@"+test.name+":"+test.arg)
+		if res.Raw != test.expect {
+			t.Fatalf("@%s:%s: expected %q, got %q", test.name, test.arg,
+				test.expect, res.Raw)
+		}
+		// the option has an effect
+		res, _ = GetE(test.json, "@"+test.name)
+		if res.Raw == test.expect {
+			t.Fatalf("@%s: %s has no effect", test.name, test.opt)
+		}
+		tested[test.name+"."+test.opt] = true
+	}
+	for _, info := range infos {
+		if !info.Builtin {
+			continue
+		}
+		if info.Positional && len(info.Args) != 1 {
+			t.Fatalf("@%s: positional with %d options", info.Name,
+				len(info.Args))
+		}
+		for _, arg := range info.Args {
+			if !tested[info.Name+"."+arg.Name] {
+				t.Fatalf("@%s: option %q is not tested", info.Name, arg.Name)
+			}
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	json := `{"a":{"b":{"c":{"d":{"e":1}}}},"arr":[1,2,3,4,5,6,7,8,9,10],
+		"s":"hello"}`
+	isLimit := func(err error, limit string) bool {
+		var lerr *LimitError
+		return errors.As(err, &lerr) && lerr.Limit == limit
+	}
+
+	// no limits
+	e := NewEngine(Config{})
+	assert(t, e.newBudget() == nil)
+	res, err := e.GetE(json, `..@dig:e`)
+	assert(t, err == nil && res.Raw == "")
+	res, err = e.GetE(json, `@dig:e`)
+	assert(t, err == nil && res.Raw == "[1]")
+
+	// depth
+	e = NewEngine(Config{MaxDepth: 3})
+	res, err = e.GetE(json, `a.b.c.d.e`)
+	assert(t, err == nil && res.Int() == 1)
+	res, err = e.GetE(json, `{x:{y:a}}`)
+	assert(t, err == nil && res.Get("x.y.b").Exists())
+	_, err = e.GetE(json, `{x:{y:{z:a}}}`)
+	assert(t, isLimit(err, "depth"))
+	assert(t, err.Error() == "gjson: depth limit of 3 exceeded")
+	_, err = e.GetE(json, `@dig:e`)
+	assert(t, isLimit(err, "depth"))
+	res, err = NewEngine(Config{MaxDepth: 10}).GetE(json, `@dig:e`)
+	assert(t, err == nil && res.Raw == "[1]")
+
+	// result size
+	e = NewEngine(Config{MaxResultSize: 10})
+	res, err = e.GetE(json, `a.b.c.d.e`)
+	assert(t, err == nil && res.Int() == 1)
+	_, err = e.GetE(json, `arr`)
+	assert(t, isLimit(err, "result size"))
+	_, err = e.GetE(json, `[arr,arr]|#`)
+	assert(t, isLimit(err, "result size"))
+	_, err = e.GetE(json, `arr|@reverse|#`)
+	assert(t, isLimit(err, "result size"))
+	res, err = e.GetE(json, `arr.#`)
+	assert(t, err == nil && res.Int() == 10)
+
+	// modifiers
+	e = NewEngine(Config{MaxModifiers: 2})
+	res, err = e.GetE(json, `s|@upper|@reverse`)
+	assert(t, err == nil && res.String() == "HELLO")
+	_, err = e.GetE(json, `s|@upper|@lower|@upper`)
+	assert(t, isLimit(err, "modifiers"))
+	_, err = e.GetE(json, `arr|@map:@this.@this`)
+	assert(t, isLimit(err, "modifiers"))
+
+	// steps
+	e = NewEngine(Config{MaxSteps: 10})
+	res, err = e.GetE(json, `arr.2`)
+	assert(t, err == nil && res.Int() == 3)
+	_, err = e.GetE(json, `arr.#(>100)`)
+	assert(t, isLimit(err, "steps"))
+	var big strings.Builder
+	big.WriteString(`[`)
+	for i := 0; i < 1000; i++ {
+		if i > 0 {
+			big.WriteByte(',')
+		}
+		big.WriteString(`{"a":1}`)
+	}
+	big.WriteString(`]`)
+	_, err = e.GetE(big.String(), `#.a`)
+	assert(t, isLimit(err, "steps"))
+	_, err = e.GetE(big.String(), `999.a`)
+	assert(t, isLimit(err, "steps"))
+	_, err = e.GetE(big.String(), `@dig:a`)
+	assert(t, isLimit(err, "steps"))
+	res, err = NewEngine(Config{MaxSteps: 2000}).GetE(big.String(), `999.a`)
+	assert(t, err == nil && res.Int() == 1)
+
+	// limits are not wrapped by a custom modifier
+	e = NewEngine(Config{MaxSteps: 5})
+	e.AddModifierFunc("get", func(ctx ModContext, json, arg string) (string, error) {
+		res, err := ctx.Get(json, arg)
+		return res.Raw, err
+	})
+	_, err = e.GetE(json, `@get:arr.9`)
+	var merr *ModifierError
+	assert(t, isLimit(err, "steps") && !errors.As(err, &merr))
+}
+
+func TestModifierLimits(t *testing.T) {
+	isLimit := func(err error, limit string) bool {
+		var lerr *LimitError
+		return errors.As(err, &lerr) && lerr.Limit == limit
+	}
+	var arr, obj strings.Builder
+	arr.WriteString(`[`)
+	obj.WriteString(`{`)
+	for i := 0; i < 50000; i++ {
+		if i > 0 {
+			arr.WriteByte(',')
+			obj.WriteByte(',')
+		}
+		arr.WriteString(`{"a":"x"}`)
+		fmt.Fprintf(&obj, `"k%d":"x"`, i)
+	}
+	arr.WriteString(`]`)
+	obj.WriteString(`}`)
+
+	// every modifier that iterates stops after the steps
+	noSteps := map[string]bool{
+		// these modifiers do not scan the elements of their json
+		"type": true, "exists": true, "isnull": true, "default": true,
+		"coalesce": true, "base64": true, "unbase64": true, "hex": true,
+		"urlencode": true, "urldecode": true, "fromstr": true,
+	}
+	paths := []string{
+		`@pretty`, `@ugly`, `@reverse`, `@this`, `@flatten`, `@join`,
+		`@valid`, `@keys`, `@values`, `@tostr`, `@group`,
+		`@dig:a`, `@sort`, `@sum:a`, `@avg:a`, `@min:a`, `@max:a`,
+		`@count:a`, `@unique`, `@slice:{"start":1}`, `@first`, `@last`,
+		`@skip`, `@map:a`, `@filter:a=="x"`, `@pick:a`, `@omit:a`,
+		`@rename:{"a":"b"}`, `@entries`, `@fromentries`, `@flattenobj`,
+		`@unflatten`, `@lower`, `@upper`, `@trim`, `@split:,`,
+		`@replace:x,y`, `@substr:1`, `@concat`, `@sha256`, `@md5`,
+		`@crc32`, `@len`, `@groupby:a`, `@zip`, `@chunk:2`, `@window:2`,
+	}
+	tested := make(map[string]bool)
+	e := NewEngine(Config{MaxSteps: 100})
+	for _, path := range paths {
+		json := arr.String()
+		name, _, _ := strings.Cut(path[1:], ":")
+		switch name {
+		case "entries", "unflatten", "keys", "values":
+			json = obj.String()
+		case "zip":
+			json = `[` + strings.Repeat(`["x"],`, 49999) + `["x"]]`
+		}
+		_, err := e.GetE(json, path)
+		if !isLimit(err, "steps") {
+			t.Fatalf("%s: expected the steps limit, got %v", path, err)
+		}
+		tested[name] = true
+	}
+	for _, info := range e.Modifiers() {
+		if !tested[info.Name] && !noSteps[info.Name] {
+			t.Fatalf("@%s is not tested", info.Name)
+		}
+	}
+
+	// the depth of the values that modifiers process
+	nested := strings.Repeat(`{"a":`, 100000) + `1` +
+		strings.Repeat(`}`, 100000)
+	e = NewEngine(Config{MaxDepth: 10})
+	for _, path := range []string{`@flattenobj`, `@sha256`,
+		`@pick:{"keys":["a"],"deep":true}`, `@this`, `@pretty`,
+		`[@this]|@unique`, `[@this]|@groupby`} {
+		_, err := e.GetE(nested, path)
+		if !isLimit(err, "depth") {
+			t.Fatalf("%s: expected the depth limit, got %v", path, err)
+		}
+	}
+	res, err := NewEngine(Config{MaxDepth: 10}).GetE(`{"a":{"b":[1]}}`,
+		`@flattenobj`)
+	assert(t, err == nil && res.Raw == `{"a.b.0":1}`)
+
+	// the size of the json that modifiers build
+	e = NewEngine(Config{MaxResultSize: 1000})
+	for _, path := range []string{`@window:1000`, `@entries`, `@dig:a`,
+		`@map:{"b":"a","c":"a"}`} {
+		json := `[` + strings.Repeat(`{"a":1},`, 999) + `{"a":1}]`
+		if path == `@entries` {
+			json = `{` + strings.Repeat(`"a":1,`, 50) + `"a":1}`
+		}
+		_, err := e.GetE(json, path)
+		if !isLimit(err, "result size") {
+			t.Fatalf("%s: expected the result size limit, got %v", path, err)
+		}
+	}
+}
+
+func TestGetContext(t *testing.T) {
+	var big strings.Builder
+	big.WriteString(`[`)
+	for i := 0; i < 1000; i++ {
+		if i > 0 {
+			big.WriteByte(',')
+		}
+		big.WriteString(`{"a":{"b":1}}`)
+	}
+	big.WriteString(`]`)
+	json := big.String()
+
+	res, err := GetContext(context.Background(), json, `#.a.b|@sum`)
+	assert(t, err == nil && res.Int() == 1000)
+	ctx, cancel := context.WithCancel(context.Background())
+	res, err = GetContext(ctx, json, `999.a.b`)
+	assert(t, err == nil && res.Int() == 1)
+	cancel()
+	_, err = GetContext(ctx, json, `0`)
+	assert(t, err == context.Canceled)
+
+	// canceled during the evaluation
+	e := NewEngine(Config{})
+	var cancels int
+	var hasContext bool
+	e.AddModifierFunc("cancel", func(mctx ModContext, json, arg string) (string, error) {
+		hasContext = mctx.Context != nil
+		cancels++
+		cancel()
+		return json, nil
+	})
+	for _, path := range []string{`@cancel|#.a.b`, `@cancel|999`,
+		`@cancel|@dig:b`, `@cancel|#(a.b==2)`, `@cancel|@map:a`} {
+		ctx, cancel = context.WithCancel(context.Background())
+		_, err = e.GetContext(ctx, json, path)
+		assert(t, err == context.Canceled)
+	}
+	assert(t, cancels == 5 && hasContext)
+	_, err = e.GetE(`{}`, `@cancel`)
+	assert(t, err == nil && !hasContext)
+
+	// context errors are not wrapped by a modifier
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	e.AddModifierFunc("wait", func(mctx ModContext, json, arg string) (string, error) {
+		<-mctx.Context.Done()
+		return "", mctx.Context.Err()
+	})
+	_, err = e.GetContext(ctx, json, `@wait`)
+	var merr *ModifierError
+	assert(t, err == context.DeadlineExceeded && !errors.As(err, &merr))
+}
+
+func TestForEachLineContext(t *testing.T) {
+	lines := `{"a":1}` + "\n" + `{"a":2}` + "\n" + `{"a":3}` + "\n"
+	var n int64
+	err := ForEachLineContext(context.Background(), lines, func(line Result) bool {
+		n += line.Get("a").Int()
+		return true
+	})
+	assert(t, err == nil && n == 6)
+	ctx, cancel := context.WithCancel(context.Background())
+	n = 0
+	err = ForEachLineContext(ctx, lines, func(line Result) bool {
+		n += line.Get("a").Int()
+		if n == 3 {
+			cancel()
+		}
+		return true
+	})
+	assert(t, err == context.Canceled && n == 3)
+	n = 0
+	err = ForEachLineContext(context.Background(), lines, func(line Result) bool {
+		n++
+		return false
+	})
+	assert(t, err == nil && n == 1)
+}
+
+func TestPolicy(t *testing.T) {
+	json := `{"name":{"first":"Tom","last":"Anderson"},"age":37,
+		"friends":[{"first":"Dale","age":44},{"first":"Roger","age":68}]}`
+	isPolicy := func(err error, feature string) bool {
+		var perr *PolicyError
+		return errors.As(err, &perr) && perr.Feature == feature
+	}
+
+	// the zero value only allows plain paths
+	e := NewEngine(Config{Policy: &Policy{}})
+	res, err := e.GetE(json, `name.last`)
+	assert(t, err == nil && res.String() == "Anderson")
+	res, err = e.GetE(json, `friends.#.first`)
+	assert(t, err == nil && res.Raw == `["Dale","Roger"]`)
+	res, err = e.GetE(json, `friends|1|first`)
+	assert(t, err == nil && res.String() == "Roger")
+	res, err = e.GetE(json, `@missing`)
+	assert(t, err == nil && !res.Exists())
+	_, err = e.GetE(json, `friends|@reverse`)
+	assert(t, isPolicy(err, "modifier"))
+	assert(t, err.Error() == "gjson: modifier @reverse is not allowed")
+	_, err = e.GetE(json, `missing.@this`)
+	assert(t, isPolicy(err, "modifier"))
+	_, err = e.GetE(json, `!true`)
+	assert(t, isPolicy(err, "literals"))
+	assert(t, err.Error() == "gjson: literals are not allowed")
+	_, err = e.GetE(json, `{name.first,age}`)
+	assert(t, isPolicy(err, "multipaths"))
+	assert(t, err.Error() == "gjson: multipaths are not allowed")
+	_, err = e.GetE(json, `[age]`)
+	assert(t, isPolicy(err, "multipaths"))
+	_, err = e.GetE(json, `friends.#(age>40).first`)
+	assert(t, isPolicy(err, "queries"))
+	assert(t, err.Error() == "gjson: queries are not allowed")
+	_, err = e.GetE(json, `friends.#(age>40)#`)
+	assert(t, isPolicy(err, "queries"))
+	_, err = e.GetE(json, `friends.#.#(age>40)`)
+	assert(t, err == nil)
+
+	// allowed features
+	e = NewEngine(Config{Policy: &Policy{
+		Modifiers:     []string{"reverse", "map", "dig"},
+		Literals:      true,
+		Multipaths:    true,
+		Queries:       true,
+		MaxPathLength: 36,
+	}})
+	res, err = e.GetE(json, `friends.#(age>40)#.first|@reverse`)
+	assert(t, err == nil && res.Raw == `["Roger","Dale"]`)
+	res, err = e.GetE(json, `{name.first,"ok":!true}`)
+	assert(t, err == nil && res.Raw == `{"first":"Tom","ok":true}`)
+	_, err = e.GetE(json, `friends|@map:@pretty`)
+	assert(t, isPolicy(err, "modifier"))
+	_, err = e.GetE(json, `@dig:first`)
+	assert(t, isPolicy(err, "recursive search"))
+	assert(t, err.Error() == "gjson: recursive search is not allowed")
+	var merr *ModifierError
+	assert(t, !errors.As(err, &merr))
+	_, err = e.GetE(json, `friends.#(first=="Dale").age.@reverse`)
+	assert(t, isPolicy(err, "path length"))
+	assert(t, err.Error() == "gjson: path is longer than 36 bytes")
+
+	// the paths of modifier args use the same policy
+	e = NewEngine(Config{Policy: &Policy{
+		Modifiers: []string{"sort", "sum", "count", "unique", "filter"},
+		Queries:   true,
+	}})
+	res, err = e.GetE(json, `friends|@sort:{"by":"age","desc":true}|#.first`)
+	assert(t, err == nil && res.Raw == `["Roger","Dale"]`)
+	res, err = e.GetE(json, `friends|@sum:age`)
+	assert(t, err == nil && res.Int() == 112)
+	for _, path := range []string{
+		`friends|@sort:{"by":"@this"}`,
+		`friends|@sum:@this`,
+		`friends|@count:{"path":"@this"}`,
+		`friends|@unique:@this`,
+		`friends|@filter:@this>1`,
+	} {
+		_, err = e.GetE(json, path)
+		assert(t, isPolicy(err, "modifier"))
+	}
+	_, err = e.GetE(json, `friends|@sort:{"by":"[age]"}`)
+	assert(t, isPolicy(err, "multipaths"))
+
+	// the queries of @filter are queries
+	e = NewEngine(Config{Policy: &Policy{Modifiers: []string{"filter"}}})
+	for _, path := range []string{
+		`friends|@filter:age>40`,
+		`friends|@filter:{"key":"0"}`,
+	} {
+		_, err = e.GetE(json, path)
+		assert(t, isPolicy(err, "queries"))
+	}
+	e = NewEngine(Config{Policy: &Policy{Modifiers: []string{"filter"},
+		Queries: true}})
+	res, err = e.GetE(json, `friends|@filter:age>60|#.first`)
+	assert(t, err == nil && res.Raw == `["Roger"]`)
+
+	// the key and aggregations of @groupby use the same policy
+	e = NewEngine(Config{Policy: &Policy{Modifiers: []string{"groupby"}}})
+	res, err = e.GetE(json, `friends|@groupby:{"key":"first"}|#.first`)
+	assert(t, err == nil && res.Raw == `["Dale","Roger"]`)
+	for _, test := range []struct{ path, feature string }{
+		{`friends|@groupby:{"key":"first|@pretty"}`, "modifier"},
+		{`friends|@groupby:{"key":"!\"lit\""}`, "literals"},
+		{`friends|@groupby:{"key":"[first,first]"}`, "multipaths"},
+		{`friends|@groupby:{"key":"first","agg":{"x":"pretty"}}`, "modifier"},
+	} {
+		_, err = e.GetE(json, test.path)
+		assert(t, isPolicy(err, test.feature))
+	}
+	e = NewEngine(Config{MaxModifiers: 1})
+	_, err = e.GetE(json, `friends|@groupby:{"key":"first",`+
+		`"agg":{"n":"count","a":"sum:age","b":"max:age"}}`)
+	var lerr *LimitError
+	assert(t, errors.As(err, &lerr) && lerr.Limit == "modifiers")
+
+	// the paths of modifier args use the modifiers of the engine
+	e = NewEngine(Config{})
+	e.AddModifier("neg", func(json, arg string) string {
+		return strconv.FormatFloat(-Parse(json).Float(), 'f', -1, 64)
+	})
+	res, err = e.GetE(json, `friends|@sort:{"by":"age.@neg"}|#.first`)
+	assert(t, err == nil && res.Raw == `["Roger","Dale"]`)
+	res, err = e.GetE(json, `friends|@max:age.@neg`)
+	assert(t, err == nil && res.Int() == -44)
+
+	// the policy is copied
+	policy := &Policy{Modifiers: []string{"reverse"}}
+	e = NewEngine(Config{Policy: policy})
+	policy.Modifiers[0] = "pretty"
+	e.Config().Policy.Modifiers[0] = "pretty"
+	_, err = e.GetE(json, `friends|@reverse`)
+	assert(t, err == nil)
+	assert(t, e.Config().Policy.Modifiers[0] == "reverse")
+	assert(t, NewEngine(Config{}).Config().Policy == nil)
+}
+
+func TestValidateWithOptions(t *testing.T) {
+	var ijson = ValidateOptions{
+		DisallowDuplicateKeys:  true,
+		DisallowInvalidUTF8:    true,
+		DisallowLoneSurrogates: true,
+		DisallowNumberOverflow: true,
+		DisallowScalars:        true,
+		MaxDepth:               3,
+	}
+	check := func(json string, opts ValidateOptions, msg string, offset int) {
+		t.Helper()
+		err := ValidateWithOptions(json, opts)
+		if msg == "" {
+			if err != nil {
+				t.Fatalf("%q: unexpected error: %v", json, err)
+			}
+			assert(t, ValidateBytesWithOptions([]byte(json), opts) == nil)
+			return
+		}
+		var verr *ValidationError
+		if !errors.As(err, &verr) || verr.Msg != msg || verr.Offset != offset {
+			t.Fatalf("%q: expected %q at %d, got %v", json, msg, offset, err)
+		}
+	}
+	none := ValidateOptions{}
+	check(`{"a":[1,2,{"b":null}],"c":"d"}`, ijson, "", 0)
+	check(` [ ] `, ijson, "", 0)
+	check(`{"a":1,"a":2}`, none, "", 0)
+	check(`{"a":1,"a":2}`, ijson, `duplicate key "a"`, 7)
+	check(`{"a":{"a":1},"b":{"a":2}}`, ijson, "", 0)
+	check("\"\xff\"", none, "", 0)
+	check("[\"ok\",\"a\xffb\"]", ijson, "invalid UTF-8", 8)
+	check("[\"héllo\"]", ijson, "", 0)
+	check(`["😀"]`, ijson, "", 0)
+	check(`["\ud83d"]`, none, "", 0)
+	check(`["\ud83d"]`, ijson, "lone surrogate", 2)
+	check(`["ab\ude00"]`, ijson, "lone surrogate", 4)
+	check(`["\ud83dA"]`, ijson, "lone surrogate", 2)
+	check(`["\ud83dx"]`, ijson, "lone surrogate", 2)
+	check(`["\\ud83d"]`, ijson, "", 0)
+	check(`[1e308,-1e308,1e-400]`, ijson, "", 0)
+	check(`[1e309]`, none, "", 0)
+	check(`[0,-1e309]`, ijson, "number is out of range", 3)
+	check(`"str"`, none, "", 0)
+	check(`"str"`, ijson, "json must be an object or an array", 0)
+	check(` 1`, ijson, "json must be an object or an array", 1)
+	check(`[[[1]]]`, ijson, "", 0)
+	check(`[[[[1]]]]`, ijson, "json is nested too deeply", 3)
+	check(`{"a":{"b":{"c":{}}}}`, ijson, "json is nested too deeply", 15)
+
+	// syntax
+	check(``, none, "unexpected end of json", 0)
+	check(`{"a":1`, none, "unexpected end of json", 6)
+	check(`{"a" 1}`, none, "expected a colon", 5)
+	check(`{1:1}`, none, "expected a key", 1)
+	check(`[1 2]`, none, "expected a comma", 3)
+	check(`[1,]`, none, "invalid character", 3)
+	check(`[tru]`, none, "invalid character", 1)
+	check(`[01]`, none, "expected a comma", 2)
+	check(`[-]`, none, "invalid number", 2)
+	check(`["a\x"]`, none, "invalid string", 4)
+	check(`{} x`, none, "invalid character after json", 3)
+	for _, json := range []string{`{}`, `[]`, `{"a":[true,false,null]}`,
+		`-0.5e+10`, `{"a":"\"\\\/\b\f\n\r\t"}`} {
+		check(json, none, "", 0)
+		assert(t, Valid(json))
+	}
+	err := ValidateWithOptions(`[1,]`, none)
+	assert(t, err.Error() == "gjson: invalid character at offset 3")
+
+	// the syntax checks agree with Valid
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	chars := []byte(`{}[]:,"\\ 01-.eEtruefalsn`)
+	for i := 0; i < 100000; i++ {
+		b := make([]byte, rng.Intn(12))
+		for j := range b {
+			b[j] = chars[rng.Intn(len(chars))]
+		}
+		if ValidBytes(b) != (ValidateBytesWithOptions(b, none) == nil) {
+			t.Fatalf("%q: mismatch with Valid", b)
+		}
+	}
+}
@@ -0,0 +1,443 @@
+package schema
+
+import (
+	"errors"
+	"go/format"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/pretty"
+)
+
+// maxEnum is the most distinct values of a string that are kept as an enum.
+const maxEnum = 10
+
+// Shape is the shape of json values, inferred from samples. It keeps the
+// types seen for each value, the members of objects and how often they
+// appear, the elements of arrays, and the distinct values of strings.
+//
+// A Shape is not safe for concurrent use.
+type Shape struct {
+	count   int // values seen
+	null    int
+	boolean int
+	integer int
+	bigint  bool // an integer is out of the range of an int64
+	number  int  // numbers that are not integers
+	str     int
+	array   int
+	object  int
+	keys    []string          // members of objects, in the order first seen
+	props   map[string]*Shape // members of objects
+	items   *Shape            // elements of arrays
+	enum    []string          // distinct strings, as json
+	enumSet map[string]bool
+	noEnum  bool // too many distinct strings
+}
+
+// InferSchema infers the shape of the json documents. An invalid document is
+// reported by its position, which starts at 1, like the lines of
+// InferSchemaLines.
+//
+//	s, err := schema.InferSchema(`{"id":1,"tags":["a"]}`, `{"id":2}`)
+//	if err != nil {
+//		return err
+//	}
+//	fmt.Println(s.JSONSchema())
+//	fmt.Println(s.GoStruct("Item"))
+func InferSchema(docs ...string) (*Shape, error) {
+	s := new(Shape)
+	for i, doc := range docs {
+		if !gjson.Valid(doc) {
+			return nil, errors.New("schema: document " + strconv.Itoa(i+1) +
+				": invalid json")
+		}
+		s.AddResult(gjson.Parse(doc))
+	}
+	return s, nil
+}
+
+// InferSchemaLines infers the shape of the documents of JSON Lines, which are
+// iterated with gjson.ForEachLine.
+func InferSchemaLines(json string) (*Shape, error) {
+	s := new(Shape)
+	var err error
+	n := 0
+	gjson.ForEachLine(json, func(line gjson.Result) bool {
+		n++
+		if !gjson.Valid(line.Raw) {
+			err = errors.New("schema: line " + strconv.Itoa(n) +
+				": invalid json")
+			return false
+		}
+		s.AddResult(line)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Add adds a json document to the samples, which allows for inferring a
+// shape from a stream of documents.
+func (s *Shape) Add(json string) error {
+	if !gjson.Valid(json) {
+		return errors.New("schema: invalid json")
+	}
+	s.AddResult(gjson.Parse(json))
+	return nil
+}
+
+// AddResult adds a value to the samples. The value is expected to be valid
+// json.
+func (s *Shape) AddResult(value gjson.Result) {
+	s.count++
+	switch {
+	case value.Type == gjson.Null:
+		s.null++
+	case value.Type == gjson.True, value.Type == gjson.False:
+		s.boolean++
+	case value.Type == gjson.Number:
+		if strings.ContainsAny(value.Raw, ".eE") {
+			s.number++
+		} else {
+			s.integer++
+			if _, err := strconv.ParseInt(value.Raw, 10, 64); err != nil {
+				s.bigint = true
+			}
+		}
+	case value.Type == gjson.String:
+		s.str++
+		s.addEnum(value)
+	case value.IsArray():
+		s.array++
+		value.ForEach(func(_, elem gjson.Result) bool {
+			if s.items == nil {
+				s.items = new(Shape)
+			}
+			s.items.AddResult(elem)
+			return true
+		})
+	case value.IsObject():
+		s.object++
+		value.ForEach(func(key, member gjson.Result) bool {
+			prop, ok := s.props[key.Str]
+			if !ok {
+				if s.props == nil {
+					s.props = make(map[string]*Shape)
+				}
+				prop = new(Shape)
+				s.props[key.Str] = prop
+				s.keys = append(s.keys, key.Str)
+			}
+			// a duplicate key is counted once
+			if prop.count < s.object {
+				prop.AddResult(member)
+			}
+			return true
+		})
+	}
+}
+
+// addEnum keeps the distinct values of a string, until there are too many.
+func (s *Shape) addEnum(value gjson.Result) {
+	if s.noEnum || s.enumSet[value.Str] {
+		return
+	}
+	if len(s.enum) == maxEnum {
+		s.noEnum, s.enum, s.enumSet = true, nil, nil
+		return
+	}
+	if s.enumSet == nil {
+		s.enumSet = make(map[string]bool)
+	}
+	s.enumSet[value.Str] = true
+	s.enum = append(s.enum, string(gjson.AppendJSONString(nil, value.Str)))
+}
+
+// types returns the JSON Schema types that were seen, where integers are
+// folded into numbers when both were seen.
+func (s *Shape) types() []string {
+	var types []string
+	if s.null > 0 {
+		types = append(types, "null")
+	}
+	if s.boolean > 0 {
+		types = append(types, "boolean")
+	}
+	if s.number > 0 {
+		types = append(types, "number")
+	} else if s.integer > 0 {
+		types = append(types, "integer")
+	}
+	if s.str > 0 {
+		types = append(types, "string")
+	}
+	if s.array > 0 {
+		types = append(types, "array")
+	}
+	if s.object > 0 {
+		types = append(types, "object")
+	}
+	return types
+}
+
+// hasEnum returns true when the values are strings, or null, that only took
+// a few distinct values, each of which was seen twice on average.
+func (s *Shape) hasEnum() bool {
+	return s.str > 0 && !s.noEnum && s.str >= 2*len(s.enum) &&
+		s.str+s.null == s.count
+}
+
+// required returns the members that were in every object.
+func (s *Shape) required() []string {
+	var required []string
+	for _, key := range s.keys {
+		if s.props[key].count == s.object {
+			required = append(required, key)
+		}
+	}
+	return required
+}
+
+// JSONSchema returns a draft 2020-12 JSON Schema that describes the samples.
+// Members that are missing from some objects are left out of "required",
+// values with more than one type have a list of types, and strings that only
+// took a few distinct values have an "enum".
+func (s *Shape) JSONSchema() string {
+	dst := []byte(`{"$schema":"https://json-schema.org/draft/2020-12/schema"`)
+	dst = s.appendSchema(dst, false)
+	return string(pretty.Pretty(dst))
+}
+
+// appendSchema appends the schema of the shape. The opening brace is left
+// out when inner is false.
+func (s *Shape) appendSchema(dst []byte, inner bool) []byte {
+	if inner {
+		dst = append(dst, '{')
+	}
+	sep := func() {
+		if dst[len(dst)-1] != '{' {
+			dst = append(dst, ',')
+		}
+	}
+	types := s.types()
+	if len(types) == 1 {
+		sep()
+		dst = append(dst, `"type":"`+types[0]+`"`...)
+	} else if len(types) > 1 {
+		sep()
+		dst = append(dst, `"type":["`+strings.Join(types, `","`)+`"]`...)
+	}
+	if s.hasEnum() {
+		sep()
+		dst = append(dst, `"enum":[`+strings.Join(s.enum, ",")...)
+		if s.null > 0 {
+			dst = append(dst, ",null"...)
+		}
+		dst = append(dst, ']')
+	}
+	if s.items != nil {
+		sep()
+		dst = append(dst, `"items":`...)
+		dst = s.items.appendSchema(dst, true)
+	}
+	if len(s.keys) > 0 {
+		sep()
+		dst = append(dst, `"properties":{`...)
+		for i, key := range s.keys {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = gjson.AppendJSONString(dst, key)
+			dst = append(dst, ':')
+			dst = s.props[key].appendSchema(dst, true)
+		}
+		dst = append(dst, '}')
+		if required := s.required(); len(required) > 0 {
+			dst = append(dst, `,"required":[`...)
+			for i, key := range required {
+				if i > 0 {
+					dst = append(dst, ',')
+				}
+				dst = gjson.AppendJSONString(dst, key)
+			}
+			dst = append(dst, ']')
+		}
+	}
+	return append(dst, '}')
+}
+
+// GoStruct returns the Go type definitions of the samples, with a struct
+// named name for the documents and a struct for each nested object, named
+// after the path to it. Optional members have the omitempty option, and
+// optional or nullable members are pointers. Integers are int64, or float64
+// when one is out of the range of an int64. Values with more than one type
+// are any. Members with names that encoding/json cannot use in a struct tag
+// are written as comments.
+func (s *Shape) GoStruct(name string) string {
+	g := goGen{names: make(map[string]bool)}
+	name = goName(name)
+	types := s.types()
+	if len(types) == 1 && types[0] == "object" && len(s.keys) > 0 {
+		g.goType(s, name, false)
+	} else {
+		typ := g.goType(s, name+"Item", false)
+		g.decls = append([]string{"type " + name + " " + typ + "\n"},
+			g.decls...)
+	}
+	src := []byte(strings.Join(g.decls, "\n"))
+	if formatted, err := format.Source(src); err == nil {
+		src = formatted
+	}
+	return string(src)
+}
+
+// goGen generates the Go type definitions of a shape.
+type goGen struct {
+	names map[string]bool // type names in use
+	decls []string        // in the order that the types are first used
+}
+
+// goType returns the Go type of a shape, declaring the structs it needs with
+// a name derived from name.
+func (g *goGen) goType(s *Shape, name string, optional bool) string {
+	types := s.types()
+	if s.null > 0 {
+		types = types[1:]
+	}
+	if len(types) != 1 {
+		return "any"
+	}
+	var typ string
+	switch types[0] {
+	case "boolean":
+		typ = "bool"
+	case "integer":
+		typ = "int64"
+		if s.bigint {
+			typ = "float64"
+		}
+	case "number":
+		typ = "float64"
+	case "string":
+		typ = "string"
+	case "array":
+		if s.items == nil {
+			return "[]any"
+		}
+		return "[]" + g.goType(s.items, name, false)
+	case "object":
+		if len(s.keys) == 0 {
+			return "map[string]any"
+		}
+		typ = g.goStruct(s, name)
+	}
+	if optional || s.null > 0 {
+		typ = "*" + typ
+	}
+	return typ
+}
+
+// goStruct declares the struct of an object shape, and returns its name.
+func (g *goGen) goStruct(s *Shape, name string) string {
+	typeName := name
+	for i := 2; g.names[typeName]; i++ {
+		typeName = name + strconv.Itoa(i)
+	}
+	g.names[typeName] = true
+	// the struct is declared before the structs of its members
+	idx := len(g.decls)
+	g.decls = append(g.decls, "")
+	var src strings.Builder
+	src.WriteString("type " + typeName + " struct {\n")
+	fields := make(map[string]bool)
+	for _, key := range s.keys {
+		if !validTag(key) {
+			src.WriteString("// member " + strconv.Quote(key) +
+				" cannot be used in a struct tag\n")
+			continue
+		}
+		field := goName(key)
+		for i := 2; fields[field]; i++ {
+			field = goName(key) + strconv.Itoa(i)
+		}
+		fields[field] = true
+		prop := s.props[key]
+		optional := prop.count < s.object
+		tag := key
+		if key == "-" || optional {
+			// a "-" by itself skips the field
+			tag += ","
+		}
+		if optional {
+			tag += "omitempty"
+		}
+		src.WriteString(field + " " + g.goType(prop, typeName+field, optional) +
+			" `json:\"" + tag + "\"`\n")
+	}
+	src.WriteString("}\n")
+	g.decls[idx] = src.String()
+	return typeName
+}
+
+// validTag returns true when a member name can be used as the name of a json
+// struct tag, which are the same names that encoding/json accepts.
+func validTag(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, r := range key {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) &&
+			!strings.ContainsRune("!#$%&()*+-./:;<=>?@[]^_{|}~ ", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// initialisms are the words that are all upper case in Go names.
+var initialisms = map[string]bool{
+	"API": true, "HTML": true, "HTTP": true, "ID": true, "IP": true,
+	"JSON": true, "SQL": true, "URI": true, "URL": true, "UUID": true,
+}
+
+// goName returns an exported Go name for a json member, such as "UserID" for
+// "user_id" or "userId".
+func goName(key string) string {
+	var words []string
+	var word []rune
+	prev := rune(0)
+	for _, r := range key {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if len(word) > 0 {
+				words, word = append(words, string(word)), nil
+			}
+		} else {
+			if unicode.IsUpper(r) && unicode.IsLower(prev) && len(word) > 0 {
+				words, word = append(words, string(word)), nil
+			}
+			word = append(word, r)
+		}
+		prev = r
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	var name strings.Builder
+	for _, word := range words {
+		if initialisms[strings.ToUpper(word)] {
+			name.WriteString(strings.ToUpper(word))
+			continue
+		}
+		rs := []rune(word)
+		name.WriteString(string(unicode.ToUpper(rs[0])) + string(rs[1:]))
+	}
+	if name.Len() == 0 || unicode.IsDigit([]rune(name.String())[0]) {
+		return "X" + name.String()
+	}
+	return name.String()
+}
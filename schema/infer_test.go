@@ -0,0 +1,186 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+var inferDocs = []string{
+	`{"id":1,"name":"Tom","status":"active","score":1,"tags":["a"],
+	  "address":{"city":"Paris","zip":"75001"},"friends":[{"user_id":2}]}`,
+	`{"id":2,"name":"Jane","status":"inactive","score":2.5,"tags":[],
+	  "address":null,"friends":[{"user_id":3,"note":"hi"}]}`,
+	`{"id":3,"name":"Roger","status":"active","score":3,"extra":true,
+	  "address":{"city":"Rome","zip":"00100"},"friends":[]}`,
+	`{"id":4,"name":"Alice","status":"active","score":4,"tags":["b",1],
+	  "address":{"city":"Oslo","zip":"0150"},"friends":[]}`,
+}
+
+func TestInferSchema(t *testing.T) {
+	s, err := InferSchema(inferDocs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	js := s.JSONSchema()
+	for path, expect := range map[string]string{
+		`\$schema`:                                      `"https://json-schema.org/draft/2020-12/schema"`,
+		`type`:                                          `"object"`,
+		`required`:                                      `["id","name","status","score","address","friends"]`,
+		`properties.id.type`:                            `"integer"`,
+		`properties.name.type`:                          `"string"`,
+		`properties.name.enum`:                          ``,
+		`properties.status.enum`:                        `["active","inactive"]`,
+		`properties.score.type`:                         `"number"`,
+		`properties.tags.items.type`:                    `["integer","string"]`,
+		`properties.address.type`:                       `["null","object"]`,
+		`properties.address.required`:                   `["city","zip"]`,
+		`properties.extra.type`:                         `"boolean"`,
+		`properties.friends.items.required`:             `["user_id"]`,
+		`properties.friends.items.properties.note.type`: `"string"`,
+		`properties|@keys`: `["id","name","status","score","tags","address",` +
+			`"friends","extra"]`,
+	} {
+		if res := gjson.Get(js, path+"|@ugly"); res.Raw != expect {
+			t.Fatalf("%s: expected %s, got %s", path, expect, res.Raw)
+		}
+	}
+	// the samples match the inferred schema
+	compiled := MustCompile(js)
+	for _, doc := range inferDocs {
+		if err := compiled.Validate(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := InferSchema(`{}`, `{`); err == nil ||
+		err.Error() != "schema: document 2: invalid json" {
+		t.Fatalf("unexpected %v", err)
+	}
+	s, _ = InferSchema()
+	if s.JSONSchema() != "{\n  \"$schema\": "+
+		"\"https://json-schema.org/draft/2020-12/schema\"\n}\n" {
+		t.Fatal(s.JSONSchema())
+	}
+}
+
+func TestInferSchemaLines(t *testing.T) {
+	lines := ""
+	for _, doc := range inferDocs {
+		lines += gjson.Get(doc, "@ugly").Raw + "\n"
+	}
+	s1, err := InferSchemaLines(lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2 := new(Shape)
+	for _, doc := range inferDocs {
+		if err := s2.Add(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s3, _ := InferSchema(inferDocs...)
+	if s1.JSONSchema() != s3.JSONSchema() ||
+		s2.JSONSchema() != s3.JSONSchema() {
+		t.Fatal("mismatch")
+	}
+	if _, err := InferSchemaLines("{}\n{\"a\":}\n"); err == nil ||
+		err.Error() != "schema: line 2: invalid json" {
+		t.Fatalf("unexpected %v", err)
+	}
+	if err := s2.Add(`[`); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestInferEnum(t *testing.T) {
+	for _, test := range []struct {
+		docs   []string
+		expect string
+	}{
+		{[]string{`"a"`}, ``},
+		{[]string{`"a"`, `"a"`}, `["a"]`},
+		{[]string{`"a"`, `"b"`, `"a"`, `null`, `"b"`}, `["a","b",null]`},
+		{[]string{`"a"`, `"a"`, `1`}, ``},
+		{[]string{`"a"`, `"b"`, `"c"`, `"a"`, `"b"`, `"c"`, `"d"`, `"e"`,
+			`"f"`, `"g"`, `"h"`, `"i"`, `"j"`, `"k"`, `"a"`, `"a"`, `"a"`,
+			`"a"`, `"a"`, `"a"`, `"a"`, `"a"`, `"a"`, `"a"`}, ``},
+	} {
+		s, _ := InferSchema(test.docs...)
+		if res := gjson.Get(s.JSONSchema(), "enum|@ugly"); res.Raw != test.expect {
+			t.Fatalf("%v: expected %s, got %s", test.docs, test.expect, res.Raw)
+		}
+	}
+}
+
+func TestGoStruct(t *testing.T) {
+	s, _ := InferSchema(inferDocs...)
+	expect := "type Person struct {\n" +
+		"\tID      int64           `json:\"id\"`\n" +
+		"\tName    string          `json:\"name\"`\n" +
+		"\tStatus  string          `json:\"status\"`\n" +
+		"\tScore   float64         `json:\"score\"`\n" +
+		"\tTags    []any           `json:\"tags,omitempty\"`\n" +
+		"\tAddress *PersonAddress  `json:\"address\"`\n" +
+		"\tFriends []PersonFriends `json:\"friends\"`\n" +
+		"\tExtra   *bool           `json:\"extra,omitempty\"`\n" +
+		"}\n\n" +
+		"type PersonAddress struct {\n" +
+		"\tCity string `json:\"city\"`\n" +
+		"\tZip  string `json:\"zip\"`\n" +
+		"}\n\n" +
+		"type PersonFriends struct {\n" +
+		"\tUserID int64   `json:\"user_id\"`\n" +
+		"\tNote   *string `json:\"note,omitempty\"`\n" +
+		"}\n"
+	if src := s.GoStruct("person"); src != expect {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expect, src)
+	}
+
+	s, _ = InferSchema(`[{"a-b":1,"a_b":2,"9x":[[1.5]],"q\"":1}]`)
+	expect = "type Items []ItemsItem\n\n" +
+		"type ItemsItem struct {\n" +
+		"\tAB  int64       `json:\"a-b\"`\n" +
+		"\tAB2 int64       `json:\"a_b\"`\n" +
+		"\tX9x [][]float64 `json:\"9x\"`\n" +
+		"\t// member \"q\\\"\" cannot be used in a struct tag\n" +
+		"}\n"
+	if src := s.GoStruct("Items"); src != expect {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expect, src)
+	}
+	s, _ = InferSchema(`{"-":1,"":2,"it's":3,"a b":4}`, `{"-":1}`)
+	expect = "type Odd struct {\n" +
+		"\tX int64 `json:\"-,\"`\n" +
+		"\t// member \"\" cannot be used in a struct tag\n" +
+		"\t// member \"it's\" cannot be used in a struct tag\n" +
+		"\tAB *int64 `json:\"a b,omitempty\"`\n" +
+		"}\n"
+	if src := s.GoStruct("Odd"); src != expect {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expect, src)
+	}
+	s, _ = InferSchema(`{"a":9223372036854775807,"b":1}`,
+		`{"a":-9223372036854775808,"b":9223372036854775808}`)
+	expect = "type Big struct {\n" +
+		"\tA int64   `json:\"a\"`\n" +
+		"\tB float64 `json:\"b\"`\n" +
+		"}\n"
+	if src := s.GoStruct("Big"); src != expect {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expect, src)
+	}
+	s, _ = InferSchema(`1`, `"a"`)
+	if src := s.GoStruct("Value"); src != "type Value any\n" {
+		t.Fatal(src)
+	}
+	s, _ = InferSchema(`{}`)
+	if src := s.GoStruct("Value"); src != "type Value map[string]any\n" {
+		t.Fatal(src)
+	}
+	for key, expect := range map[string]string{
+		"userId": "UserID", "first_name": "FirstName", "URL": "URL",
+		"api-key": "APIKey", "": "X", "1st": "X1st", "héllo": "Héllo",
+	} {
+		if name := goName(key); name != expect {
+			t.Fatalf("%q: expected %q, got %q", key, expect, name)
+		}
+	}
+}
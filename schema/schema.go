@@ -0,0 +1,1176 @@
+// Package schema validates json documents against a JSON Schema using the
+// gjson scanner, without decoding the documents into Go values.
+//
+// The core keywords of draft 2020-12 are supported, which are the
+// applicators $ref, allOf, anyOf, oneOf, not, if, then, else,
+// dependentSchemas, prefixItems, items, contains, properties,
+// patternProperties, additionalProperties, and propertyNames, and the
+// validation keywords type, enum, const, multipleOf, maximum,
+// exclusiveMaximum, minimum, exclusiveMinimum, maxLength, minLength, pattern,
+// maxItems, minItems, uniqueItems, maxContains, minContains, maxProperties,
+// minProperties, required, and dependentRequired. Other keywords, such as
+// format, are ignored.
+//
+// References must point into the same schema, either with a JSON Pointer,
+// such as "#/$defs/name", or with an $anchor, such as "#name". Remote
+// references, and references to the $id of a subschema, are not supported.
+//
+//	s, err := schema.Compile(`{
+//		"type": "object",
+//		"properties": {"age": {"type": "integer", "minimum": 0}},
+//		"required": ["age"]
+//	}`)
+//	if err != nil {
+//		return err
+//	}
+//	err = s.Validate(`{"age":-1}`)
+//	// err: schema: age: must be >= 0
+package schema
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tidwall/gjson"
+)
+
+// Schema is a compiled JSON Schema. A Schema is safe for concurrent use.
+type Schema struct {
+	root *node
+}
+
+// Error is a single problem with a json document.
+type Error struct {
+	// Path is the GJSON path of the value, in the same form that
+	// Result.Path returns, such as "friends.1.age", or "@this" for the
+	// document itself.
+	Path string
+	// Keyword is the schema keyword that failed, such as "minimum".
+	Keyword string
+	// Message describes the problem.
+	Message string
+}
+
+func (err Error) Error() string {
+	return err.Path + ": " + err.Message
+}
+
+// ValidationError is returned by Validate when a json document does not
+// match the schema.
+type ValidationError struct {
+	Errors []Error
+}
+
+func (err *ValidationError) Error() string {
+	msg := "schema: " + err.Errors[0].Error()
+	if len(err.Errors) > 1 {
+		msg += " (and " + strconv.Itoa(len(err.Errors)-1) + " more errors)"
+	}
+	return msg
+}
+
+// node is a compiled schema or subschema.
+type node struct {
+	bool  bool // boolean schema
+	value bool // value of a boolean schema
+
+	ref    string
+	refTo  *node
+	types  []string
+	enum   []gjson.Result
+	consts []gjson.Result // zero or one const value
+
+	multipleOf       *decimal
+	maximum          *float64
+	exclusiveMaximum *float64
+	minimum          *float64
+	exclusiveMinimum *float64
+
+	maxLength     int
+	minLength     int
+	pattern       *regexp.Regexp
+	maxItems      int
+	minItems      int
+	uniqueItems   bool
+	maxContains   int
+	minContains   int
+	maxProperties int
+	minProperties int
+	required      []string
+
+	dependentRequired map[string][]string
+	dependentSchemas  map[string]*node
+
+	allOf []*node
+	anyOf []*node
+	oneOf []*node
+	not   *node
+	ifs   *node
+	then  *node
+	els   *node
+
+	prefixItems          []*node
+	items                *node
+	contains             *node
+	properties           map[string]*node
+	patternProperties    []patternNode
+	additionalProperties *node
+	propertyNames        *node
+}
+
+type patternNode struct {
+	re   *regexp.Regexp
+	node *node
+}
+
+// compiler compiles the subschemas of a schema.
+type compiler struct {
+	root    gjson.Result
+	id      string           // $id of the root, without the fragment
+	nodes   map[string]*node // subschemas by JSON Pointer
+	anchors map[string]*node
+	refs    []*node // nodes with a $ref to resolve
+}
+
+// Compile parses a JSON Schema.
+func Compile(schema string) (*Schema, error) {
+	if !gjson.Valid(schema) {
+		return nil, errors.New("schema: invalid json")
+	}
+	c := &compiler{
+		root:    gjson.Parse(schema),
+		nodes:   make(map[string]*node),
+		anchors: make(map[string]*node),
+	}
+	if id := c.root.Get(`\$id`); id.Type == gjson.String {
+		c.id, _, _ = strings.Cut(id.Str, "#")
+	}
+	root, err := c.compile(c.root, "")
+	if err != nil {
+		return nil, err
+	}
+	// resolve the references, which may compile more subschemas
+	for len(c.refs) > 0 {
+		n := c.refs[len(c.refs)-1]
+		c.refs = c.refs[:len(c.refs)-1]
+		if n.refTo, err = c.resolve(n.ref); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.checkLoops(); err != nil {
+		return nil, err
+	}
+	return &Schema{root: root}, nil
+}
+
+// MustCompile is like Compile but panics when the schema cannot be compiled.
+func MustCompile(schema string) *Schema {
+	s, err := Compile(schema)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// inPlace returns the subschemas of a node that apply to the same value as
+// the node, rather than to one of its members or elements.
+func (n *node) inPlace() []*node {
+	subs := []*node{n.refTo, n.not, n.ifs, n.then, n.els}
+	subs = append(subs, n.allOf...)
+	subs = append(subs, n.anyOf...)
+	subs = append(subs, n.oneOf...)
+	for _, sub := range n.dependentSchemas {
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// checkLoops returns an error when references loop back to a subschema
+// without moving into a member or element of the value, such as two $refs
+// to each other, because the validation would never end.
+func (c *compiler) checkLoops() error {
+	const visiting, visited = 1, 2
+	ptrs := make([]string, 0, len(c.nodes))
+	nodePtrs := make(map[*node]string, len(c.nodes))
+	for ptr, n := range c.nodes {
+		ptrs = append(ptrs, ptr)
+		nodePtrs[n] = ptr
+	}
+	sort.Strings(ptrs)
+	state := make(map[*node]int)
+	var loop *node
+	var visit func(n *node) bool
+	visit = func(n *node) bool {
+		switch state[n] {
+		case visiting:
+			loop = n
+			return false
+		case visited:
+			return true
+		}
+		state[n] = visiting
+		for _, sub := range n.inPlace() {
+			if sub != nil && !visit(sub) {
+				return false
+			}
+		}
+		state[n] = visited
+		return true
+	}
+	for _, ptr := range ptrs {
+		if !visit(c.nodes[ptr]) {
+			return c.fail(nodePtrs[loop],
+				"$ref loops without validating a nested value")
+		}
+	}
+	return nil
+}
+
+// resolve returns the subschema of a $ref.
+func (c *compiler) resolve(ref string) (*node, error) {
+	uri, frag, _ := strings.Cut(ref, "#")
+	if uri != "" && uri != c.id {
+		return nil, errors.New("schema: unsupported $ref " + strconv.Quote(ref))
+	}
+	frag, err := url.PathUnescape(frag)
+	if err != nil {
+		return nil, errors.New("schema: invalid $ref " + strconv.Quote(ref))
+	}
+	if frag != "" && frag[0] != '/' {
+		if n, ok := c.anchors[frag]; ok {
+			return n, nil
+		}
+		return nil, errors.New("schema: unknown anchor in $ref " +
+			strconv.Quote(ref))
+	}
+	if n, ok := c.nodes[frag]; ok {
+		return n, nil
+	}
+	var path []string
+	for _, token := range strings.Split(frag, "/")[1:] {
+		token = strings.ReplaceAll(token, "~1", "/")
+		token = strings.ReplaceAll(token, "~0", "~")
+		path = append(path, gjson.Escape(token))
+	}
+	value := c.root
+	if len(path) > 0 {
+		value = c.root.Get(strings.Join(path, "."))
+	}
+	if !value.Exists() {
+		return nil, errors.New("schema: unknown $ref " + strconv.Quote(ref))
+	}
+	return c.compile(value, frag)
+}
+
+// compile compiles the schema at the JSON Pointer ptr.
+func (c *compiler) compile(s gjson.Result, ptr string) (*node, error) {
+	if n, ok := c.nodes[ptr]; ok {
+		return n, nil
+	}
+	n := &node{
+		maxLength: -1, minLength: -1, maxItems: -1, minItems: -1,
+		maxContains: -1, minContains: -1, maxProperties: -1,
+		minProperties: -1,
+	}
+	c.nodes[ptr] = n
+	if s.IsBool() {
+		n.bool, n.value = true, s.Bool()
+		return n, nil
+	}
+	if !s.IsObject() {
+		return nil, c.fail(ptr, "a schema must be an object or a boolean")
+	}
+	var err error
+	s.ForEach(func(key, value gjson.Result) bool {
+		err = c.keyword(n, key.Str, value, ptr+"/"+escapePointer(key.Str))
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// keyword compiles one keyword of a schema.
+func (c *compiler) keyword(n *node, key string, v gjson.Result, ptr string,
+) (err error) {
+	switch key {
+	case "$ref":
+		if v.Type != gjson.String {
+			return c.fail(ptr, "must be a string")
+		}
+		n.ref = v.Str
+		c.refs = append(c.refs, n)
+	case "$anchor":
+		if v.Type != gjson.String {
+			return c.fail(ptr, "must be a string")
+		}
+		c.anchors[v.Str] = n
+	case "$defs":
+		if !v.IsObject() {
+			return c.fail(ptr, "must be an object")
+		}
+		v.ForEach(func(key, value gjson.Result) bool {
+			_, err = c.compile(value, ptr+"/"+escapePointer(key.Str))
+			return err == nil
+		})
+	case "type":
+		if v.Type == gjson.String {
+			n.types = []string{v.Str}
+		} else if v.IsArray() {
+			v.ForEach(func(_, value gjson.Result) bool {
+				n.types = append(n.types, value.String())
+				return true
+			})
+		} else {
+			return c.fail(ptr, "must be a string or an array")
+		}
+		for _, t := range n.types {
+			switch t {
+			case "null", "boolean", "object", "array", "number", "string",
+				"integer":
+			default:
+				return c.fail(ptr, "unknown type "+strconv.Quote(t))
+			}
+		}
+	case "enum":
+		if !v.IsArray() {
+			return c.fail(ptr, "must be an array")
+		}
+		n.enum = v.Array()
+	case "const":
+		n.consts = []gjson.Result{v}
+	case "multipleOf":
+		if n.multipleOf, err = c.decimal(v, ptr); err == nil &&
+			(n.multipleOf.neg || n.multipleOf.digits == "") {
+			err = c.fail(ptr, "must be greater than zero")
+		}
+	case "maximum":
+		n.maximum, err = c.number(v, ptr)
+	case "exclusiveMaximum":
+		n.exclusiveMaximum, err = c.number(v, ptr)
+	case "minimum":
+		n.minimum, err = c.number(v, ptr)
+	case "exclusiveMinimum":
+		n.exclusiveMinimum, err = c.number(v, ptr)
+	case "maxLength":
+		n.maxLength, err = c.count(v, ptr)
+	case "minLength":
+		n.minLength, err = c.count(v, ptr)
+	case "maxItems":
+		n.maxItems, err = c.count(v, ptr)
+	case "minItems":
+		n.minItems, err = c.count(v, ptr)
+	case "maxContains":
+		n.maxContains, err = c.count(v, ptr)
+	case "minContains":
+		n.minContains, err = c.count(v, ptr)
+	case "maxProperties":
+		n.maxProperties, err = c.count(v, ptr)
+	case "minProperties":
+		n.minProperties, err = c.count(v, ptr)
+	case "pattern":
+		n.pattern, err = c.regexp(v, ptr)
+	case "uniqueItems":
+		n.uniqueItems = v.Bool()
+	case "required":
+		n.required, err = c.strings(v, ptr)
+	case "dependentRequired":
+		if !v.IsObject() {
+			return c.fail(ptr, "must be an object")
+		}
+		n.dependentRequired = make(map[string][]string)
+		v.ForEach(func(key, value gjson.Result) bool {
+			n.dependentRequired[key.Str], err = c.strings(value,
+				ptr+"/"+escapePointer(key.Str))
+			return err == nil
+		})
+	case "dependentSchemas":
+		n.dependentSchemas, err = c.schemaMap(v, ptr)
+	case "allOf":
+		n.allOf, err = c.schemaArray(v, ptr)
+	case "anyOf":
+		n.anyOf, err = c.schemaArray(v, ptr)
+	case "oneOf":
+		n.oneOf, err = c.schemaArray(v, ptr)
+	case "not":
+		n.not, err = c.compile(v, ptr)
+	case "if":
+		n.ifs, err = c.compile(v, ptr)
+	case "then":
+		n.then, err = c.compile(v, ptr)
+	case "else":
+		n.els, err = c.compile(v, ptr)
+	case "prefixItems":
+		n.prefixItems, err = c.schemaArray(v, ptr)
+	case "items":
+		n.items, err = c.compile(v, ptr)
+	case "contains":
+		n.contains, err = c.compile(v, ptr)
+	case "properties":
+		n.properties, err = c.schemaMap(v, ptr)
+	case "patternProperties":
+		if !v.IsObject() {
+			return c.fail(ptr, "must be an object")
+		}
+		v.ForEach(func(key, value gjson.Result) bool {
+			var pn patternNode
+			kptr := ptr + "/" + escapePointer(key.Str)
+			if pn.re, err = c.regexp(key, kptr); err != nil {
+				return false
+			}
+			if pn.node, err = c.compile(value, kptr); err != nil {
+				return false
+			}
+			n.patternProperties = append(n.patternProperties, pn)
+			return true
+		})
+	case "additionalProperties":
+		n.additionalProperties, err = c.compile(v, ptr)
+	case "propertyNames":
+		n.propertyNames, err = c.compile(v, ptr)
+	}
+	return err
+}
+
+func (c *compiler) fail(ptr, msg string) error {
+	if ptr == "" {
+		ptr = "#"
+	} else {
+		ptr = "#" + ptr
+	}
+	return errors.New("schema: " + ptr + ": " + msg)
+}
+
+func (c *compiler) number(v gjson.Result, ptr string) (*float64, error) {
+	if v.Type != gjson.Number {
+		return nil, c.fail(ptr, "must be a number")
+	}
+	return &v.Num, nil
+}
+
+func (c *compiler) decimal(v gjson.Result, ptr string) (*decimal, error) {
+	d, ok := parseDecimal(v.Raw)
+	if v.Type != gjson.Number || !ok {
+		return nil, c.fail(ptr, "must be a number")
+	}
+	return &d, nil
+}
+
+func (c *compiler) count(v gjson.Result, ptr string) (int, error) {
+	if v.Type != gjson.Number || v.Num < 0 || v.Num != math.Trunc(v.Num) {
+		return 0, c.fail(ptr, "must be a non-negative integer")
+	}
+	if v.Num > math.MaxInt32 {
+		return math.MaxInt32, nil
+	}
+	return int(v.Num), nil
+}
+
+func (c *compiler) regexp(v gjson.Result, ptr string) (*regexp.Regexp, error) {
+	if v.Type != gjson.String {
+		return nil, c.fail(ptr, "must be a string")
+	}
+	re, err := regexp.Compile(v.Str)
+	if err != nil {
+		return nil, c.fail(ptr, "invalid pattern: "+err.Error())
+	}
+	return re, nil
+}
+
+func (c *compiler) strings(v gjson.Result, ptr string) ([]string, error) {
+	if !v.IsArray() {
+		return nil, c.fail(ptr, "must be an array")
+	}
+	var strs []string
+	var ok = true
+	v.ForEach(func(_, value gjson.Result) bool {
+		strs = append(strs, value.Str)
+		ok = value.Type == gjson.String
+		return ok
+	})
+	if !ok {
+		return nil, c.fail(ptr, "must be an array of strings")
+	}
+	return strs, nil
+}
+
+func (c *compiler) schemaArray(v gjson.Result, ptr string) ([]*node, error) {
+	if !v.IsArray() {
+		return nil, c.fail(ptr, "must be an array")
+	}
+	var nodes []*node
+	var err error
+	var i int
+	v.ForEach(func(_, value gjson.Result) bool {
+		var n *node
+		n, err = c.compile(value, ptr+"/"+strconv.Itoa(i))
+		nodes = append(nodes, n)
+		i++
+		return err == nil
+	})
+	return nodes, err
+}
+
+func (c *compiler) schemaMap(v gjson.Result, ptr string,
+) (map[string]*node, error) {
+	if !v.IsObject() {
+		return nil, c.fail(ptr, "must be an object")
+	}
+	nodes := make(map[string]*node)
+	var err error
+	v.ForEach(func(key, value gjson.Result) bool {
+		nodes[key.Str], err = c.compile(value, ptr+"/"+escapePointer(key.Str))
+		return err == nil
+	})
+	return nodes, err
+}
+
+// escapePointer escapes a JSON Pointer token.
+func escapePointer(token string) string {
+	token = strings.ReplaceAll(token, "~", "~0")
+	return strings.ReplaceAll(token, "/", "~1")
+}
+
+// Validate returns a ValidationError with every problem of the json document,
+// or nil when it matches the schema.
+func (s *Schema) Validate(json string) error {
+	if !gjson.Valid(json) {
+		return &ValidationError{Errors: []Error{{Path: "@this",
+			Keyword: "", Message: "invalid json"}}}
+	}
+	return s.ValidateResult(gjson.Parse(json))
+}
+
+// ValidateBytes returns a ValidationError with every problem of the json
+// document, or nil when it matches the schema.
+func (s *Schema) ValidateBytes(json []byte) error {
+	if !gjson.ValidBytes(json) {
+		return &ValidationError{Errors: []Error{{Path: "@this",
+			Keyword: "", Message: "invalid json"}}}
+	}
+	return s.ValidateResult(gjson.ParseBytes(json))
+}
+
+// ValidateResult returns a ValidationError with every problem of a value, or
+// nil when it matches the schema. The value is expected to be valid json, and
+// the paths of the errors are relative to the value.
+func (s *Schema) ValidateResult(value gjson.Result) error {
+	v := validator{collect: true}
+	if !v.validate(s.root, value) {
+		return &ValidationError{Errors: v.errs}
+	}
+	return nil
+}
+
+// validator validates a value against a node. When collect is false the
+// validation stops at the first problem, which is used by the applicators
+// that only need to know if a subschema matches, like anyOf.
+type validator struct {
+	collect bool
+	path    []string
+	errs    []Error
+}
+
+// fail records a problem, and returns false.
+func (v *validator) fail(keyword, msg string) bool {
+	if v.collect {
+		path := "@this"
+		if len(v.path) > 0 {
+			comps := make([]string, len(v.path))
+			for i, comp := range v.path {
+				comps[i] = gjson.Escape(comp)
+			}
+			path = strings.Join(comps, ".")
+		}
+		v.errs = append(v.errs, Error{Path: path, Keyword: keyword,
+			Message: msg})
+	}
+	return false
+}
+
+// matches returns true when the value matches the node, without recording
+// any problems.
+func (v *validator) matches(n *node, value gjson.Result) bool {
+	sub := validator{path: v.path}
+	return sub.validate(n, value)
+}
+
+// child validates the value of an object member or array element.
+func (v *validator) child(n *node, comp string, value gjson.Result) bool {
+	v.path = append(v.path, comp)
+	ok := v.validate(n, value)
+	v.path = v.path[:len(v.path)-1]
+	return ok
+}
+
+// validate returns true when the value matches the node.
+func (v *validator) validate(n *node, value gjson.Result) bool {
+	if n.bool {
+		if !n.value {
+			return v.fail("false", "not allowed")
+		}
+		return true
+	}
+	ok := true
+	// check runs a keyword, and stops the validation at the first problem
+	// when the problems are not collected
+	check := func(valid bool) bool {
+		ok = ok && valid
+		return valid || v.collect
+	}
+	if n.refTo != nil && !check(v.validate(n.refTo, value)) {
+		return false
+	}
+	if len(n.types) > 0 && !check(v.validateType(n, value)) {
+		return false
+	}
+	if len(n.enum) > 0 {
+		var found bool
+		for _, e := range n.enum {
+			if equal(e, value) {
+				found = true
+				break
+			}
+		}
+		if !check(found || v.fail("enum", "must be one of the enum values")) {
+			return false
+		}
+	}
+	for _, c := range n.consts {
+		if !check(equal(c, value) || v.fail("const", "must be "+c.Raw)) {
+			return false
+		}
+	}
+	switch {
+	case value.Type == gjson.Number:
+		if !check(v.validateNumber(n, value)) {
+			return false
+		}
+	case value.Type == gjson.String:
+		if !check(v.validateString(n, value)) {
+			return false
+		}
+	case value.IsArray():
+		if !check(v.validateArray(n, value)) {
+			return false
+		}
+	case value.IsObject():
+		if !check(v.validateObject(n, value)) {
+			return false
+		}
+	}
+	if !check(v.validateApplicators(n, value)) {
+		return false
+	}
+	return ok
+}
+
+func (v *validator) validateType(n *node, value gjson.Result) bool {
+	for _, t := range n.types {
+		if typeOf(value, t) {
+			return true
+		}
+	}
+	return v.fail("type", "must be of type "+strings.Join(n.types, " or "))
+}
+
+// typeOf returns true when the value is of the JSON Schema type.
+func typeOf(value gjson.Result, t string) bool {
+	switch t {
+	case "null":
+		return value.Type == gjson.Null
+	case "boolean":
+		return value.IsBool()
+	case "object":
+		return value.IsObject()
+	case "array":
+		return value.IsArray()
+	case "number":
+		return value.Type == gjson.Number
+	case "string":
+		return value.Type == gjson.String
+	case "integer":
+		if value.Type != gjson.Number {
+			return false
+		}
+		d, ok := parseDecimal(value.Raw)
+		return ok && d.isInt()
+	}
+	return false
+}
+
+func (v *validator) validateNumber(n *node, value gjson.Result) bool {
+	ok := true
+	num := value.Num
+	if n.multipleOf != nil {
+		d, valid := parseDecimal(value.Raw)
+		if valid && !d.multipleOf(*n.multipleOf) {
+			ok = v.fail("multipleOf", "must be a multiple of "+
+				n.multipleOf.String())
+			if !v.collect {
+				return false
+			}
+		}
+	}
+	limits := []struct {
+		keyword string
+		limit   *float64
+		valid   func(a, b float64) bool
+		op      string
+	}{
+		{"maximum", n.maximum, func(a, b float64) bool { return a <= b }, "<="},
+		{"exclusiveMaximum", n.exclusiveMaximum,
+			func(a, b float64) bool { return a < b }, "<"},
+		{"minimum", n.minimum, func(a, b float64) bool { return a >= b }, ">="},
+		{"exclusiveMinimum", n.exclusiveMinimum,
+			func(a, b float64) bool { return a > b }, ">"},
+	}
+	for _, l := range limits {
+		if l.limit != nil && !l.valid(num, *l.limit) {
+			ok = v.fail(l.keyword, "must be "+l.op+" "+
+				strconv.FormatFloat(*l.limit, 'f', -1, 64))
+			if !v.collect {
+				return false
+			}
+		}
+	}
+	return ok
+}
+
+func (v *validator) validateString(n *node, value gjson.Result) bool {
+	ok := true
+	if n.maxLength >= 0 || n.minLength >= 0 {
+		length := utf8.RuneCountInString(value.Str)
+		if n.maxLength >= 0 && length > n.maxLength {
+			ok = v.fail("maxLength", "must have at most "+
+				strconv.Itoa(n.maxLength)+" characters")
+			if !v.collect {
+				return false
+			}
+		}
+		if n.minLength >= 0 && length < n.minLength {
+			ok = v.fail("minLength", "must have at least "+
+				strconv.Itoa(n.minLength)+" characters")
+			if !v.collect {
+				return false
+			}
+		}
+	}
+	if n.pattern != nil && !n.pattern.MatchString(value.Str) {
+		ok = v.fail("pattern", "must match the pattern "+
+			strconv.Quote(n.pattern.String()))
+	}
+	return ok
+}
+
+func (v *validator) validateArray(n *node, value gjson.Result) bool {
+	ok := true
+	items := value.Array()
+	if n.maxItems >= 0 && len(items) > n.maxItems {
+		ok = v.fail("maxItems", "must have at most "+
+			strconv.Itoa(n.maxItems)+" items")
+		if !v.collect {
+			return false
+		}
+	}
+	if n.minItems >= 0 && len(items) < n.minItems {
+		ok = v.fail("minItems", "must have at least "+
+			strconv.Itoa(n.minItems)+" items")
+		if !v.collect {
+			return false
+		}
+	}
+	if n.uniqueItems {
+	unique:
+		for i := 1; i < len(items); i++ {
+			for j := 0; j < i; j++ {
+				if equal(items[i], items[j]) {
+					ok = v.fail("uniqueItems", "items "+strconv.Itoa(j)+
+						" and "+strconv.Itoa(i)+" must be unique")
+					if !v.collect {
+						return false
+					}
+					break unique
+				}
+			}
+		}
+	}
+	for i, item := range items {
+		var sub *node
+		if i < len(n.prefixItems) {
+			sub = n.prefixItems[i]
+		} else if n.items != nil {
+			sub = n.items
+		} else {
+			break
+		}
+		if !v.child(sub, strconv.Itoa(i), item) {
+			ok = false
+			if !v.collect {
+				return false
+			}
+		}
+	}
+	if n.contains != nil {
+		var count int
+		for _, item := range items {
+			if v.matches(n.contains, item) {
+				count++
+			}
+		}
+		min := 1
+		if n.minContains >= 0 {
+			min = n.minContains
+		}
+		if count < min {
+			ok = v.fail("contains", "must contain at least "+
+				strconv.Itoa(min)+" matching items")
+			if !v.collect {
+				return false
+			}
+		}
+		if n.maxContains >= 0 && count > n.maxContains {
+			ok = v.fail("maxContains", "must contain at most "+
+				strconv.Itoa(n.maxContains)+" matching items")
+		}
+	}
+	return ok
+}
+
+func (v *validator) validateObject(n *node, value gjson.Result) bool {
+	ok := true
+	var count int
+	value.ForEach(func(key, member gjson.Result) bool {
+		count++
+		matched := false
+		if sub, has := n.properties[key.Str]; has {
+			matched = true
+			if !v.child(sub, key.Str, member) {
+				ok = false
+			}
+		}
+		for _, pn := range n.patternProperties {
+			if pn.re.MatchString(key.Str) {
+				matched = true
+				if !v.child(pn.node, key.Str, member) {
+					ok = false
+				}
+			}
+		}
+		if !matched && n.additionalProperties != nil {
+			if !v.child(n.additionalProperties, key.Str, member) {
+				ok = false
+			}
+		}
+		if n.propertyNames != nil && !v.matches(n.propertyNames, key) {
+			v.path = append(v.path, key.Str)
+			ok = v.fail("propertyNames", "invalid property name")
+			v.path = v.path[:len(v.path)-1]
+		}
+		return ok || v.collect
+	})
+	if !ok && !v.collect {
+		return false
+	}
+	if n.maxProperties >= 0 && count > n.maxProperties {
+		ok = v.fail("maxProperties", "must have at most "+
+			strconv.Itoa(n.maxProperties)+" properties")
+		if !v.collect {
+			return false
+		}
+	}
+	if n.minProperties >= 0 && count < n.minProperties {
+		ok = v.fail("minProperties", "must have at least "+
+			strconv.Itoa(n.minProperties)+" properties")
+		if !v.collect {
+			return false
+		}
+	}
+	for _, name := range n.required {
+		if !has(value, name) {
+			ok = v.fail("required", "missing property "+strconv.Quote(name))
+			if !v.collect {
+				return false
+			}
+		}
+	}
+	for name, required := range n.dependentRequired {
+		if !has(value, name) {
+			continue
+		}
+		for _, req := range required {
+			if !has(value, req) {
+				ok = v.fail("dependentRequired", "missing property "+
+					strconv.Quote(req)+", which is required by "+
+					strconv.Quote(name))
+				if !v.collect {
+					return false
+				}
+			}
+		}
+	}
+	for name, sub := range n.dependentSchemas {
+		if has(value, name) && !v.validate(sub, value) {
+			ok = false
+			if !v.collect {
+				return false
+			}
+		}
+	}
+	return ok
+}
+
+// has returns true when the object has a member with the name.
+func has(obj gjson.Result, name string) bool {
+	var found bool
+	obj.ForEach(func(key, _ gjson.Result) bool {
+		found = key.Str == name
+		return !found
+	})
+	return found
+}
+
+func (v *validator) validateApplicators(n *node, value gjson.Result) bool {
+	ok := true
+	for _, sub := range n.allOf {
+		if !v.validate(sub, value) {
+			ok = false
+			if !v.collect {
+				return false
+			}
+		}
+	}
+	if len(n.anyOf) > 0 {
+		var found bool
+		for _, sub := range n.anyOf {
+			if v.matches(sub, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ok = v.fail("anyOf", "must match at least one schema in anyOf")
+			if !v.collect {
+				return false
+			}
+		}
+	}
+	if len(n.oneOf) > 0 {
+		var count int
+		for _, sub := range n.oneOf {
+			if v.matches(sub, value) {
+				count++
+			}
+		}
+		if count != 1 {
+			ok = v.fail("oneOf", "must match exactly one schema in oneOf, "+
+				"but matches "+strconv.Itoa(count))
+			if !v.collect {
+				return false
+			}
+		}
+	}
+	if n.not != nil && v.matches(n.not, value) {
+		ok = v.fail("not", "must not match the schema in not")
+		if !v.collect {
+			return false
+		}
+	}
+	if n.ifs != nil {
+		if v.matches(n.ifs, value) {
+			if n.then != nil && !v.validate(n.then, value) {
+				ok = false
+			}
+		} else if n.els != nil && !v.validate(n.els, value) {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// equal returns true when two json values are equal, where numbers are
+// compared by value and object members are compared in any order.
+func equal(a, b gjson.Result) bool {
+	switch {
+	case a.Type == gjson.Number && b.Type == gjson.Number:
+		if a.Raw == b.Raw {
+			return true
+		}
+		da, ok1 := parseDecimal(a.Raw)
+		db, ok2 := parseDecimal(b.Raw)
+		return ok1 && ok2 && !da.clamped && da == db
+	case a.IsArray() && b.IsArray():
+		ae, be := a.Array(), b.Array()
+		if len(ae) != len(be) {
+			return false
+		}
+		for i := range ae {
+			if !equal(ae[i], be[i]) {
+				return false
+			}
+		}
+		return true
+	case a.IsObject() && b.IsObject():
+		am, bm := a.Map(), b.Map()
+		if len(am) != len(bm) {
+			return false
+		}
+		for key, av := range am {
+			bv, ok := bm[key]
+			if !ok || !equal(av, bv) {
+				return false
+			}
+		}
+		return true
+	case a.Type == gjson.JSON || b.Type == gjson.JSON:
+		return false
+	case a.Type == gjson.String:
+		return b.Type == gjson.String && a.Str == b.Str
+	}
+	return a.Type == b.Type
+}
+
+// decimal is the exact value of a json number, which is digits * 10^exp.
+// The digits have no leading or trailing zeros, and are empty for zero. It's
+// used instead of big.Rat, which does not parse exponents of 1e7 and more.
+type decimal struct {
+	neg     bool
+	digits  string
+	exp     int
+	clamped bool // the exponent is larger than maxExp
+}
+
+// maxExp is the largest exponent of a decimal. Larger exponents are clamped,
+// which keeps their sign, and such decimals are not equal to any other.
+const maxExp = 100000000
+
+// parseDecimal parses a json number.
+func parseDecimal(raw string) (decimal, bool) {
+	var d decimal
+	if len(raw) > 0 && raw[0] == '-' {
+		d.neg = true
+		raw = raw[1:]
+	}
+	digits := func(i int) int {
+		for i < len(raw) && raw[i] >= '0' && raw[i] <= '9' {
+			i++
+		}
+		return i
+	}
+	i := digits(0)
+	if i == 0 {
+		return decimal{}, false
+	}
+	ipart, fpart := raw[:i], ""
+	if i < len(raw) && raw[i] == '.' {
+		j := digits(i + 1)
+		if j == i+1 {
+			return decimal{}, false
+		}
+		fpart, i = raw[i+1:j], j
+	}
+	if i < len(raw) && (raw[i] == 'e' || raw[i] == 'E') {
+		i++
+		neg := i < len(raw) && raw[i] == '-'
+		if i < len(raw) && (raw[i] == '-' || raw[i] == '+') {
+			i++
+		}
+		j := digits(i)
+		if j == i {
+			return decimal{}, false
+		}
+		for _, c := range raw[i:j] {
+			if d.exp = d.exp*10 + int(c-'0'); d.exp > maxExp {
+				d.exp, d.clamped = maxExp, true
+				break
+			}
+		}
+		if neg {
+			d.exp = -d.exp
+		}
+		i = j
+	}
+	if i != len(raw) {
+		return decimal{}, false
+	}
+	d.digits = strings.TrimLeft(ipart+fpart, "0")
+	n := len(d.digits)
+	d.digits = strings.TrimRight(d.digits, "0")
+	if d.digits == "" {
+		return decimal{}, true
+	}
+	if !d.clamped {
+		d.exp += n - len(d.digits) - len(fpart)
+	}
+	return d, true
+}
+
+// isInt returns true when the decimal is an integer.
+func (d decimal) isInt() bool {
+	return d.digits == "" || d.exp >= 0
+}
+
+// multipleOf returns true when the decimal is an integer multiple of m,
+// which is greater than zero.
+func (d decimal) multipleOf(m decimal) bool {
+	if d.digits == "" {
+		return true
+	}
+	shift := d.exp - m.exp
+	num, _ := new(big.Int).SetString(d.digits, 10)
+	den, _ := new(big.Int).SetString(m.digits, 10)
+	if shift < 0 {
+		// m*10^-shift is larger than d
+		if -shift > len(d.digits) {
+			return false
+		}
+		den.Mul(den, pow10(-shift))
+	} else {
+		// more powers of ten do not add factors other than 2 and 5, and
+		// m.digits has fewer than 4*len(m.digits) of either
+		if shift > 4*len(m.digits) {
+			shift = 4 * len(m.digits)
+		}
+		num.Mul(num, pow10(shift))
+	}
+	return num.Rem(num, den).Sign() == 0
+}
+
+// String returns the decimal as a json number.
+func (d decimal) String() string {
+	if d.digits == "" {
+		return "0"
+	}
+	var s string
+	switch n := len(d.digits) + d.exp; {
+	case d.exp >= 0 && n <= 21:
+		s = d.digits + strings.Repeat("0", d.exp)
+	case d.exp < 0 && n > 0:
+		s = d.digits[:n] + "." + d.digits[n:]
+	case d.exp < 0 && n > -6:
+		s = "0." + strings.Repeat("0", -n) + d.digits
+	default:
+		s = d.digits[:1]
+		if len(d.digits) > 1 {
+			s += "." + d.digits[1:]
+		}
+		s += "e" + strconv.Itoa(n-1)
+	}
+	if d.neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// pow10 returns 10^n.
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
@@ -0,0 +1,294 @@
+package schema
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+// runSuite runs the test files in the format of the JSON Schema Test Suite,
+// which is an array of groups with a "schema" and "tests". The groups in
+// skips, by file and description, are skipped with the reason. When skips is
+// nil, the groups with unsupported references are skipped instead.
+func runSuite(t *testing.T, files []string, skips map[string]string) {
+	seen := make(map[string]bool)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gjson.ParseBytes(data).ForEach(func(_, group gjson.Result) bool {
+			name := filepath.Base(file) + "/" + group.Get("description").String()
+			seen[name] = true
+			t.Run(name, func(t *testing.T) {
+				if reason, ok := skips[name]; ok {
+					t.Skip(reason)
+				}
+				s, err := Compile(group.Get("schema").Raw)
+				if err != nil {
+					if skips == nil &&
+						strings.Contains(err.Error(), "unsupported") {
+						t.Skip(err)
+					}
+					t.Fatal(err)
+				}
+				group.Get("tests").ForEach(func(_, test gjson.Result) bool {
+					err := s.Validate(test.Get("data").Raw)
+					valid := test.Get("valid").Bool()
+					if valid != (err == nil) {
+						t.Errorf("%s: expected valid=%t, got %v",
+							test.Get("description").String(), valid, err)
+					}
+					return true
+				})
+			})
+			return true
+		})
+	}
+	for name := range skips {
+		if !seen[name] {
+			t.Errorf("skipped group %q is not in the suite", name)
+		}
+	}
+}
+
+const (
+	skipRemote  = "remote references are not supported"
+	skipID      = "references to the $id of a subschema are not supported"
+	skipKeyword = "unevaluatedProperties is not supported"
+)
+
+// suiteSkips are the groups of testdata/draft2020-12 that need references or
+// keywords that are not supported.
+var suiteSkips = map[string]string{
+	"anchor.json/Location-independent identifier with absolute URI": skipID,
+	"anchor.json/Location-independent identifier with base URI " +
+		"change in subschema": skipID,
+	"anchor.json/same $anchor with different base uri":       skipID,
+	"ref.json/remote ref, containing refs itself":            skipRemote,
+	"ref.json/Recursive references between schemas":          skipID,
+	"ref.json/refs with relative uris and defs":              skipID,
+	"ref.json/relative refs with absolute uris and defs":     skipID,
+	"ref.json/order of evaluation: $id and $ref":             skipID,
+	"ref.json/order of evaluation: $id and $anchor and $ref": skipID,
+	"ref.json/URN base URI with f-component":                 skipRemote,
+	"ref.json/URN ref with nested pointer ref":               skipID,
+	"ref.json/ref to if":                                     skipID,
+	"ref.json/ref to then":                                   skipID,
+	"ref.json/ref to else":                                   skipID,
+	"ref.json/ref with absolute-path-reference":              skipID,
+	"ref.json/$id must be resolved against nearest parent, " +
+		"not just immediate parent": skipID,
+	"ref.json/ref creates new scope when adjacent to keywords": skipKeyword,
+}
+
+// TestSuite runs the tests of testdata, where testdata/draft2020-12 has the
+// draft 2020-12 tests of the official JSON Schema Test Suite for the
+// supported keywords, with the groups of suiteSkips skipped.
+func TestSuite(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.json")
+	if err != nil || len(files) == 0 {
+		t.Fatal("missing testdata")
+	}
+	suite, err := filepath.Glob("testdata/draft2020-12/*.json")
+	if err != nil || len(suite) == 0 {
+		t.Fatal("missing testdata/draft2020-12")
+	}
+	runSuite(t, files, map[string]string{})
+	runSuite(t, suite, suiteSkips)
+}
+
+// TestOfficialSuite runs the draft 2020-12 tests of the official JSON Schema
+// Test Suite when JSON_SCHEMA_TEST_SUITE is the path of a checkout of
+// https://github.com/json-schema-org/JSON-Schema-Test-Suite.
+func TestOfficialSuite(t *testing.T) {
+	dir := os.Getenv("JSON_SCHEMA_TEST_SUITE")
+	if dir == "" {
+		t.Skip("JSON_SCHEMA_TEST_SUITE is not set")
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "tests", "draft2020-12",
+		"*.json"))
+	if err != nil || len(files) == 0 {
+		t.Fatal("missing draft2020-12 tests")
+	}
+	unsupported := map[string]bool{
+		"defs.json": true, "dynamicRef.json": true,
+		"id.json": true, "refRemote.json": true, "unevaluatedItems.json": true,
+		"unevaluatedProperties.json": true, "vocabulary.json": true,
+		"content.json": true, "unknownKeyword.json": true,
+	}
+	var supported []string
+	for _, file := range files {
+		if !unsupported[filepath.Base(file)] {
+			supported = append(supported, file)
+		}
+	}
+	runSuite(t, supported, nil)
+}
+
+func TestErrors(t *testing.T) {
+	s := MustCompile(`{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string", "minLength": 1},
+			"friends": {
+				"type": "array",
+				"items": {
+					"type": "object",
+					"properties": {"age": {"type": "integer", "minimum": 0}},
+					"required": ["age"]
+				}
+			},
+			"fav.movie": {"type": "string"}
+		},
+		"required": ["name"]
+	}`)
+	json := `{"name":"","friends":[{"age":1},{"age":-1},{}],"fav.movie":1}`
+	err := s.Validate(json)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	expect := []Error{
+		{Path: "name", Keyword: "minLength",
+			Message: "must have at least 1 characters"},
+		{Path: "friends.1.age", Keyword: "minimum", Message: "must be >= 0"},
+		{Path: "friends.2", Keyword: "required",
+			Message: `missing property "age"`},
+		{Path: `fav\.movie`, Keyword: "type", Message: "must be of type string"},
+	}
+	if len(verr.Errors) != len(expect) {
+		t.Fatalf("expected %d errors, got %v", len(expect), verr.Errors)
+	}
+	for i, err := range verr.Errors {
+		if err != expect[i] {
+			t.Fatalf("expected %v, got %v", expect[i], err)
+		}
+		// the paths work with gjson
+		if err.Keyword != "required" && !gjson.Get(json, err.Path).Exists() {
+			t.Fatalf("path %q does not exist", err.Path)
+		}
+	}
+	if err.Error() != "schema: name: must have at least 1 characters "+
+		"(and 3 more errors)" {
+		t.Fatal(err.Error())
+	}
+	// the paths are the same as Result.Path
+	res := gjson.Get(json, "friends.#(age<0).age")
+	if res.Path(json) != verr.Errors[1].Path {
+		t.Fatalf("expected %q, got %q", res.Path(json), verr.Errors[1].Path)
+	}
+
+	err = s.Validate(`[]`)
+	if !errors.As(err, &verr) || verr.Errors[0].Path != "@this" ||
+		err.Error() != "schema: @this: must be of type object" {
+		t.Fatalf("unexpected %v", err)
+	}
+	err = s.Validate(`{"name":`)
+	if err == nil || err.Error() != "schema: @this: invalid json" {
+		t.Fatalf("unexpected %v", err)
+	}
+	if err := s.ValidateBytes([]byte(`{"name":"Tom"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ValidateBytes([]byte(`{"name":1}`)); err == nil {
+		t.Fatal("expected an error")
+	}
+	friend := gjson.Get(json, "friends.1")
+	err = MustCompile(`{"properties":{"age":{"minimum":0}}}`).
+		ValidateResult(friend)
+	if !errors.As(err, &verr) || verr.Errors[0].Path != "age" {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	// subschemas of anyOf do not report their problems
+	err = MustCompile(`{"anyOf":[{"type":"string"},{"minimum":5}]}`).
+		Validate(`1`)
+	if !errors.As(err, &verr) || len(verr.Errors) != 1 ||
+		verr.Errors[0].Keyword != "anyOf" {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	// multipleOf is written as a json number
+	for multipleOf, expect := range map[string]string{
+		"0.5": "0.5", "15e-1": "1.5", "1e-7": "1e-7", "0.0001": "0.0001",
+		"12e30": "1.2e31", "3e-9999999": "3e-9999999", "1500": "1500",
+	} {
+		err = MustCompile(`{"multipleOf":` + multipleOf + `}`).
+			Validate(`1.0000000001e-9999999`)
+		if err == nil || err.Error() !=
+			"schema: @this: must be a multiple of "+expect {
+			t.Fatalf("%s: unexpected %v", multipleOf, err)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, test := range []struct {
+		schema string
+		err    string
+	}{
+		{`{`, "schema: invalid json"},
+		{`1`, "schema: #: a schema must be an object or a boolean"},
+		{`{"type":"int"}`, `schema: #/type: unknown type "int"`},
+		{`{"minLength":-1}`,
+			"schema: #/minLength: must be a non-negative integer"},
+		{`{"properties":{"a":{"maximum":"1"}}}`,
+			"schema: #/properties/a/maximum: must be a number"},
+		{`{"multipleOf":0}`, "schema: #/multipleOf: must be greater than zero"},
+		{`{"multipleOf":-1e-9999999}`,
+			"schema: #/multipleOf: must be greater than zero"},
+		{`{"pattern":"("}`, "schema: #/pattern: invalid pattern: " +
+			"error parsing regexp: missing closing ): `(`"},
+		{`{"required":[1]}`, "schema: #/required: must be an array of strings"},
+		{`{"$ref":"#/$defs/missing"}`,
+			`schema: unknown $ref "#/$defs/missing"`},
+		{`{"$ref":"#missing"}`, `schema: unknown anchor in $ref "#missing"`},
+		{`{"$ref":"https://example.com/s.json"}`,
+			`schema: unsupported $ref "https://example.com/s.json"`},
+		{`{"$defs":{"a":{"$ref":"#/$defs/b"},"b":{"$ref":"#/$defs/a"}},` +
+			`"$ref":"#/$defs/a"}`, "schema: #/$defs/a: $ref loops without " +
+			"validating a nested value"},
+		{`{"$ref":"#"}`,
+			"schema: #: $ref loops without validating a nested value"},
+		{`{"allOf":[{"not":{"$ref":"#"}}]}`,
+			"schema: #: $ref loops without validating a nested value"},
+		{`{"$anchor":"a","anyOf":[{"$ref":"#a"}]}`,
+			"schema: #: $ref loops without validating a nested value"},
+	} {
+		_, err := Compile(test.schema)
+		if err == nil || err.Error() != test.err {
+			t.Fatalf("%s: expected %q, got %v", test.schema, test.err, err)
+		}
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic")
+		}
+	}()
+	MustCompile(`{"type":1}`)
+}
+
+func TestRecursiveRef(t *testing.T) {
+	// references to a parent schema are fine when they validate a nested
+	// value
+	s := MustCompile(`{
+		"$defs": {"a": {"$ref": "#/$defs/b"}, "b": {"type": "object",
+			"properties": {"next": {"$ref": "#/$defs/a"}}}},
+		"allOf": [{"$ref": "#/$defs/a"}],
+		"properties": {"child": {"$ref": "#"}},
+		"items": {"$ref": "#"}
+	}`)
+	if err := s.Validate(`{"child":{"next":{"next":{}}}}`); err != nil {
+		t.Fatal(err)
+	}
+	err := s.Validate(`{"child":{"next":{"next":1}}}`)
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.Errors[0].Path != "child.next.next" {
+		t.Fatalf("unexpected %v", err)
+	}
+}